@@ -1,180 +1,159 @@
 package main
 
 import (
+	"ArchiveProcessor/fb2"
+	"ArchiveProcessor/filter"
+	"ArchiveProcessor/genre"
+	"ArchiveProcessor/langid"
+	"ArchiveProcessor/normalize"
+	"ArchiveProcessor/segment"
+	"ArchiveProcessor/sink"
+	"ArchiveProcessor/window"
+	"ArchiveProcessor/wordpiece"
 	"archive/zip"
-	"bytes"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"math/rand"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
-	"github.com/anaskhan96/soup"
 	pb "github.com/schollz/progressbar/v3"
-	"golang.org/x/net/html/charset"
-	"golang.org/x/text/encoding/charmap"
-	"golang.org/x/text/transform"
 )
 
-type Author struct {
-	FirstName  string `json:"first_name"`
-	LastName   string `json:"last_name"`
-	MiddleName string `json:"middle_name"`
-	NickName   string `json:"nick_name"`
-}
-
-type Data struct {
-	ID         string   `json:"id"`
-	Genres     []string `json:"genre"`
-	Authors    []Author `json:"author"`
-	BookTitle  string   `json:"book_title"`
-	Body       string   `json:"body"`
-	Annotation string   `json:"annotation"`
-	FileName   string   `json:"file_name"`
-}
-
 const N = 50000
 
-var FictionGenresPrefix = []string{
-	"sf", "popadancy", "litrpg", "russian_fantasy", "popadanec",
-	"modern_tale", "hronoopera", "child_sf", "love_sf"}
-
-const IgnoreNonFictionProbability = 0.75
-
 var outputCSVPath string
 var truncateToNumChars int
 var logFilePath string
 var zipFilePattern string
-
-// TruncateText truncates text to firstN characters.
-func TruncateText(s string, firstN int) string {
-	s = strings.TrimSpace(s)
-	if len(s) < firstN {
-		firstN = len(s)
-	}
-	return s[:firstN]
-}
-
-func ExtractBook(fb2 *zip.File) (Data, error) {
-	d := Data{}
-
-	reader, err := fb2.Open()
-	if err != nil {
-		return d, fmt.Errorf("error opening file %s because %+v", fb2.Name, err)
-	}
-
-	data, err := io.ReadAll(reader)
+var imagesDir string
+var coversOnly bool
+var validateOnly bool
+var repairBooks bool
+var filters filter.Pipeline
+var genreClassesPath string
+var reportPath string
+var resume bool
+var manifestPath string
+var outputFormat string
+var genreColumns bool
+var orderedOutput bool
+var normalizeSteps normalize.Steps
+var segmentMode string
+var segmentRunes int
+var windowConfig window.Config
+var vocabPath string
+var maxTokens int
+var tokenizer *wordpiece.Tokenizer
+var classifier *genre.Classifier
+var unknownGenres = genre.NewUnknown(genre.Default())
+
+// ExtractBook parses a zipped book and returns its record and the encoding it
+// was stored in, or an error if the book is rejected. The error has a Reason,
+// see ReasonOf.
+func ExtractBook(archive string, fb2File *zip.File) (fb2.Record, string, error) {
+	reader, err := fb2File.Open()
 	if err != nil {
-		return d, err
+		return fb2.Record{}, "", reject(ReasonOpen, "error opening file %s because %+v", fb2File.Name, err)
 	}
-
-	enc, name, _ := charset.DetermineEncoding(data, "")
-	if name != "utf-8" {
-		enc = charmap.Windows1251
+	defer reader.Close()
+
+	// Only the windows of the body are kept, so there is no need to read
+	// more runes than they span unless a filter looks at the whole text.
+	// Images follow the bodies, so dumping them needs the whole book too.
+	opts := fb2.ReaderOptions{MaxTextRunes: windowConfig.MaxRunes(), Normalize: normalizeSteps, KeepBinaries: imagesDir != "", Repair: repairBooks}
+	if filters.NeedsFullText() || opts.KeepBinaries {
+		opts.MaxTextRunes = 0
 	}
-	decodedReader := transform.NewReader(bytes.NewReader(data), enc.NewDecoder())
+	book, err := fb2.ParseFictionBookReader(reader, opts)
 	if err != nil {
-		return d, fmt.Errorf("couldn't decode file because of %+v", err)
+		return fb2.Record{}, "", reject(ReasonParse, "couldn't parse file because of %+v", err)
 	}
-
-	xmlText, _ := io.ReadAll(decodedReader)
-	doc := soup.HTMLParse(string(xmlText))
-
-	langs := doc.FindAll("lang")
-	if len(langs) != 1 || langs[0].Text() != "ru" {
-		return d, fmt.Errorf("file is not in Russian")
+	if len(book.Repairs) > 0 {
+		log.Printf("Repaired %s: %v\n", fb2File.Name, fb2.CountRepairs(book.Repairs))
 	}
 
-	d.FileName = fb2.Name
-	genres := doc.FindAll("genre")
-	if len(genres) == 0 {
-		return d, fmt.Errorf("no genres found")
-	}
+	d := book.Record()
+	d.Normalize(normalizeSteps)
+	d.FileName = fb2File.Name
+	d.ID = d.FileName
 
-	hasSf := false
-	for _, genre := range genres {
-		for _, prefix := range FictionGenresPrefix {
-			if strings.HasPrefix(genre.Text(), prefix) {
-				hasSf = true
-				break
-			}
-		}
-	}
-	if !hasSf {
-		if rand.Float32() < IgnoreNonFictionProbability {
-			return d, fmt.Errorf("random ignore")
-		}
+	if len(d.Genres) == 0 {
+		return d, book.Encoding, reject(ReasonNoGenres, "no genres found")
 	}
-
-	d.Genres = make([]string, len(genres))
-	for i, genre := range genres {
-		d.Genres[i] = genre.Text()
+	if unknown := unknownGenres.Add(d.Genres); len(unknown) > 0 {
+		log.Printf("Unknown genres in %s: %s\n", fb2File.Name, strings.Join(unknown, ","))
 	}
-	d.ID = d.FileName
+	d.Genres = genre.Default().NormalizeAll(d.Genres)
+	d.GenreClass = classifier.Classify(d.Genres)
 
-	annotation := doc.FindAll("annotation")
-	if len(annotation) == 1 {
-		d.Annotation = annotation[0].FullText()
+	if d.BookTitle == "" {
+		return d, book.Encoding, reject(ReasonNoTitle, "error finding book title")
 	}
 
-	title := doc.FindAll("book-title")
-	if len(title) != 1 {
-		return d, fmt.Errorf("error finding book title")
+	if len(book.Body.Sections) == 0 {
+		return d, book.Encoding, reject(ReasonNoBody, "error finding body")
 	}
-	d.BookTitle = title[0].Text()
 
-	body := doc.FindAll("body")
-	if len(body) != 1 {
-		return d, fmt.Errorf("error finding body")
+	if len(d.Authors) == 0 {
+		return d, book.Encoding, reject(ReasonNoAuthors, "no authors found")
 	}
 
-	text := body[0].FullText()
-	d.Body = TruncateText(text, truncateToNumChars)
+	// The language is identified on the start of the body, before the
+	// windows are taken, so that the record carries it for the filters and output.
+	detected := langid.Default().Identify(d.Body)
+	d.DetectedLang, d.LangConfidence = detected.Lang, detected.Confidence
 
-	ti := doc.FindAll("title-info")
-	if len(ti) != 1 {
-		return d, fmt.Errorf("error finding title-info")
+	key := filepath.Base(archive) + "/" + fb2File.Name
+	if err := filters.Accept(&filter.Book{FictionBook: book, Record: d, Key: key}); err != nil {
+		return d, book.Encoding, err
 	}
 
-	authors := ti[0].FindAll("author")
-	if len(authors) == 0 {
-		return d, fmt.Errorf("no authors found")
+	windows := windowConfig.Windows(d.Body, key)
+	d.Body = strings.Join(windows, window.Separator)
+	if len(windows) > 1 {
+		d.Windows = windows
 	}
-
-	d.Authors = make([]Author, len(authors))
-
-	for i, author := range authors {
-		auth := Author{}
-
-		fn := author.Find("first-name")
-		if fn.Error == nil {
-			auth.FirstName = fn.Text()
-		}
-
-		ln := author.Find("last-name")
-		if ln.Error == nil {
-			auth.LastName = ln.Text()
+	switch segmentMode {
+	case "sentences":
+		d.Segments = segment.Sentences(d.Body)
+	case "segments":
+		d.Segments = segment.Pack(segment.Sentences(d.Body), segmentRunes)
+	}
+	if tokenizer != nil {
+		texts := d.Segments
+		if segmentMode == "" {
+			texts = []string{d.Body}
 		}
-
-		mn := author.Find("middle-name")
-		if mn.Error == nil {
-			auth.MiddleName = mn.Text()
+		for _, text := range texts {
+			e := tokenizer.Encode(text, maxTokens)
+			d.InputIDs = append(d.InputIDs, e.InputIDs)
+			d.AttentionMask = append(d.AttentionMask, e.AttentionMask)
 		}
+	}
 
-		nn := author.Find("nickname")
-		if nn.Error == nil {
-			auth.NickName = nn.Text()
+	if imagesDir != "" {
+		if err := DumpImages(archive, fb2File.Name, book); err != nil {
+			log.Printf("Error dumping images of %s/%s: %+v\n", archive, fb2File.Name, err)
 		}
-
-		d.Authors[i] = auth
 	}
+	return d, book.Encoding, nil
+}
 
-	return d, nil
+// DumpImages writes the cover, or all images unless coversOnly is set, of an
+// accepted book to imagesDir/<archive>/<book>/.
+func DumpImages(archive, name string, book *fb2.FictionBook) error {
+	dir := filepath.Join(imagesDir, filepath.Base(archive),
+		strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)))
+	_, err := book.WriteImages(dir, coversOnly)
+	return err
 }
 
 func expandPatterns(pattern string) ([]string, error) {
@@ -194,11 +173,46 @@ func expandPatterns(pattern string) ([]string, error) {
 
 func main() {
 	flag.StringVar(&outputCSVPath, "output", "", "Output file path")
-	flag.IntVar(&truncateToNumChars, "truncate_to", 10000, "Discard first N words")
+	flag.StringVar(&outputFormat, "format", "jsonl", "Output format: "+strings.Join(sink.Formats, ", "))
+	flag.BoolVar(&genreColumns, "genre_columns", false, "Add the GenreNames and GenreClass columns to the csv, parquet and arrow output, after the columns of json2csv")
+	flag.IntVar(&truncateToNumChars, "truncate_to", 10000, "Length of the body, or of each window, in -window_unit units")
+	windowStrategy := flag.String("window", string(window.Head), "Where the body is taken from: head, skip_front, spaced or random")
+	windowUnit := flag.String("window_unit", string(window.Runes), "Unit of -truncate_to: runes, words or sentences")
+	flag.IntVar(&windowConfig.Count, "windows", 1, "Number of windows of the spaced and random strategies")
+	flag.Uint64Var(&windowConfig.Seed, "window_seed", 0, "Seed of the random windows")
 	flag.StringVar(&logFilePath, "log", "", "Log file path")
 	flag.StringVar(&zipFilePattern, "zip_files", "", "Zip file pattern")
+	flag.StringVar(&imagesDir, "images_dir", "", "Directory to dump images of accepted books to")
+	flag.BoolVar(&coversOnly, "covers_only", false, "Dump only cover images")
+	flag.BoolVar(&repairBooks, "repair", false, "Repair malformed books instead of dropping them")
+	flag.StringVar(&genreClassesPath, "genre_classes", "", "JSON file with the genre classes written to the records")
+	flag.StringVar(&reportPath, "report", "", "JSON run report path, <output>.report.json by default")
+	flag.BoolVar(&orderedOutput, "ordered", false, "Write the records in archive order, then entry order, instead of as they are extracted")
+	flag.BoolVar(&resume, "resume", false, "Resume an interrupted run, appending the missing records to the output, with -format jsonl only as the other formats can't be appended to")
+	flag.StringVar(&manifestPath, "manifest", "", "Manifest of processed archives, only new or changed ones are processed into a new output shard")
+	normalizeList := flag.String("normalize", normalize.Default.String(), "Comma separated text normalization steps, of "+normalize.All.String()+", or none")
+	flag.StringVar(&segmentMode, "segment", "", "Split the body into \"sentences\", or \"segments\" of whole sentences up to -segment_runes")
+	flag.IntVar(&segmentRunes, "segment_runes", 512, "Maximum length of a segment in runes")
+	flag.StringVar(&vocabPath, "vocab", "", "BERT vocab.txt, such as that of rubert-base-cased, to write the input_ids and attention_mask of the body or its segments, with -format jsonl")
+	flag.IntVar(&maxTokens, "max_tokens", 128, "Length the token ids are truncated and padded to")
+	flag.BoolVar(&validateOnly, "validate", false, "Validate books against the FB2 schema instead of extracting them")
+	filterFlags := filter.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
+	filterConfig, err := filterFlags.Config()
+	if err != nil {
+		log.Fatal(err)
+	}
+	filters = filterConfig.Pipeline()
+
+	classes := genre.DefaultClasses()
+	if genreClassesPath != "" {
+		if classes, err = genre.LoadClasses(genreClassesPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	classifier = genre.NewClassifier(classes)
+
 	if len(outputCSVPath) < 1 {
 		log.Fatal("Output file path is required")
 	}
@@ -211,7 +225,55 @@ func main() {
 		log.Fatal("Zip file pattern is required")
 	}
 
-	logFile, err := os.Create(logFilePath)
+	if resume && validateOnly {
+		log.Fatal("-resume is not supported with -validate")
+	}
+
+	if !slices.Contains(sink.Formats, outputFormat) {
+		log.Fatalf("Unknown output format %q, want one of %s", outputFormat, strings.Join(sink.Formats, ", "))
+	}
+
+	windowConfig.Strategy = window.Strategy(*windowStrategy)
+	windowConfig.Unit = window.Unit(*windowUnit)
+	windowConfig.Size = truncateToNumChars
+	if err := windowConfig.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if normalizeSteps, err = normalize.ParseSteps(*normalizeList); err != nil {
+		log.Fatal(err)
+	}
+
+	if segmentMode != "" && segmentMode != "sentences" && segmentMode != "segments" {
+		log.Fatalf("Unknown segment mode %q, want sentences or segments", segmentMode)
+	}
+	if segmentRunes < 1 {
+		log.Fatal("-segment_runes must be positive")
+	}
+
+	if vocabPath != "" {
+		// The columns of the other formats have no place for the token ids.
+		if outputFormat != "jsonl" {
+			log.Fatal("-vocab is only supported with -format jsonl")
+		}
+		if maxTokens < 2 {
+			log.Fatal("-max_tokens must be at least 2")
+		}
+		if tokenizer, err = wordpiece.Load(vocabPath, wordpiece.Options{}); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// The other formats can't be appended to.
+	if resume && outputFormat != "jsonl" {
+		log.Fatal("-resume is only supported with -format jsonl")
+	}
+
+	logFlags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		logFlags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	logFile, err := os.OpenFile(logFilePath, logFlags, 0644)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -223,67 +285,265 @@ func main() {
 	// Set log flags for date and time information
 	log.SetFlags(log.Ldate | log.Ltime)
 
-	// Create a new HDF file.
-	f, err := os.Create(outputCSVPath)
+	zipFiles, err := expandPatterns(zipFilePattern)
 	if err != nil {
 		panic(err)
 	}
 
+	log.Println("Found", len(zipFiles), "zip files")
+
+	// With a manifest only the archives that are new, changed or were
+	// processed with other settings are processed, into a new output shard
+	// named after -output.
+	var manifest *Manifest
+	var fingerprint string
+	if manifestPath != "" && !validateOnly {
+		if manifest, err = LoadManifest(manifestPath); err != nil {
+			log.Fatal(err)
+		}
+		settings := struct {
+			Filters      filter.Config
+			TruncateTo   int
+			Repair       bool
+			GenreClasses []genre.Class
+			// Left out when unset, so that manifests written before
+			// segmentation, windows and tokens existed still match. The
+			// text is normalized unless -normalize is none, so archives of
+			// manifests written before normalization are processed again.
+			Normalize    normalize.Steps `json:",omitempty"`
+			Segment      string          `json:",omitempty"`
+			SegmentRunes int             `json:",omitempty"`
+			Window       *window.Config  `json:",omitempty"`
+			Vocab        string          `json:",omitempty"`
+			MaxTokens    int             `json:",omitempty"`
+		}{Filters: filterConfig, TruncateTo: truncateToNumChars, Repair: repairBooks, GenreClasses: classes, Normalize: normalizeSteps, Segment: segmentMode}
+		if tokenizer != nil {
+			settings.Vocab, settings.MaxTokens = filepath.Base(vocabPath), maxTokens
+		}
+		if windowConfig.Strategy != window.Head || windowConfig.Unit != window.Runes {
+			settings.Window = &windowConfig
+		}
+		if segmentMode == "segments" {
+			settings.SegmentRunes = segmentRunes
+		}
+		fingerprint, err = configFingerprint(settings)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var pending []string
+		for _, file := range zipFiles {
+			changed, err := manifest.Changed(file, fingerprint)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if changed {
+				pending = append(pending, file)
+			} else {
+				log.Println("Skipping unchanged", file)
+			}
+		}
+		fmt.Printf("%d of %d archives are new or changed\n", len(pending), len(zipFiles))
+		zipFiles = pending
+		if len(zipFiles) == 0 {
+			if err := manifest.Save(); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		if resume && manifest.PendingShard != "" {
+			outputCSVPath = manifest.PendingShard
+		} else {
+			outputCSVPath = shardPath(outputCSVPath, time.Now())
+		}
+		manifest.PendingShard = outputCSVPath
+		if err := manifest.Save(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Writing to", outputCSVPath)
+	}
+
+	// On resume the records already written are kept and only the missing
+	// ones appended.
+	written := make(map[string]bool)
+	outputFlags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		if written, err = ResumeOutput(outputCSVPath); err != nil {
+			log.Fatal(err)
+		}
+		outputFlags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		log.Println("Resuming with", len(written), "records written")
+	}
+	f, err := os.OpenFile(outputCSVPath, outputFlags, 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	var out sink.Sink
+	if !validateOnly {
+		columns := sink.Columns{Genres: genreColumns, Segments: segmentMode != ""}
+		if out, err = sink.New(outputFormat, f, columns); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Record the filters, with the sampling seed and rates, so that the
+	// same books can be selected again with -filter_config.
+	if !validateOnly {
+		if err := filterConfig.Save(outputCSVPath + ".filters.json"); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	const maxGoroutines = 8
 	goroutineSem := make(chan struct{}, maxGoroutines)
 
 	var wg sync.WaitGroup
 
-	zipFiles, err := expandPatterns(zipFilePattern)
-	if err != nil {
-		panic(err)
+	if reportPath == "" {
+		reportPath = outputCSVPath + ".report.json"
+	}
+	report := newRunReport()
+	report.Normalization = normalizeSteps
+
+	if validateOnly {
+		if _, err := ValidateArchives(zipFiles, f); err != nil {
+			log.Println("Aborted:", err)
+			fmt.Fprintln(os.Stderr, "Aborted:", err)
+			os.Exit(1)
+		}
+		f.Close()
+		return
 	}
 
-	log.Println("Found", len(zipFiles), "zip files")
+	checkpoint, err := OpenCheckpoint(outputCSVPath+".checkpoint", resume)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer checkpoint.Close()
+
+	// Ctrl-C stops handing out books, the ones in flight are finished and
+	// checkpointed so that the run can be resumed.
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// A write error stops the run as well.
+	running, abort := context.WithCancel(interrupted)
+	defer abort()
+
+	writer := startOutputWriter(out, checkpoint, report, orderedOutput, abort)
+	seq := 0
+	nextSeq := func() int {
+		seq++
+		return seq - 1
+	}
 
 	for n, file := range zipFiles {
+		if running.Err() != nil {
+			break
+		}
+		if checkpoint.ArchiveDone(file) {
+			fmt.Printf("Skipping file %d/%d: %s\n", n+1, len(zipFiles), file)
+			continue
+		}
 		fmt.Println(file)
 
 		r, err := zip.OpenReader(file)
 		if err != nil {
-			return
+			// The archive is left out of the checkpoint and the manifest,
+			// so that a resumed or later run tries it again.
+			log.Printf("Error opening %s: %v\n", file, err)
+			fmt.Fprintf(os.Stderr, "Error opening %s: %v\n", file, err)
+			report.failArchive(file, err)
+			continue
 		}
 
 		zippedFb2Files := r.File
 		fmt.Printf("Processing file %d/%d: %s\n", n+1, len(zipFiles), file)
-		bar := pb.New(len(zippedFb2Files))
+		archive := &archiveRun{file: file, bar: pb.New(len(zippedFb2Files)), stats: newExtractionStats()}
 
 		for _, fb2 := range zippedFb2Files {
+			if running.Err() != nil {
+				break
+			}
+			if checkpoint.EntryDone(file, fb2.Name) || written[fmt.Sprintf("%s/%s", file, fb2.Name)] {
+				writer.send(bookResult{seq: nextSeq(), archive: archive, entry: fb2.Name, skipped: true})
+				continue
+			}
+
 			goroutineSem <- struct{}{} // Wait for an available slot
 			wg.Add(1)
 
+			result := bookResult{seq: nextSeq(), archive: archive, entry: fb2.Name}
 			go func(fb2 *zip.File) {
 				defer wg.Done()
 
-				d, err := ExtractBook(fb2)
-				if err != nil {
-					log.Printf("Error extracting book %s/%s: %+v\n", file, fb2.Name, err)
-				} else {
+				d, encoding, err := ExtractBook(file, fb2)
+				if err == nil {
 					d.ID = fmt.Sprintf("%s/%s", file, d.ID)
-					jsdata, err := json.Marshal(d)
-					if err != nil {
-						log.Printf("Error marshalling data %+v\n", err)
-					} else {
-						f.Write(jsdata)
-						f.WriteString("\n")
-						bar.Add(1)
-					}
 				}
+				result.record, result.encoding, result.err = d, encoding, err
+				writer.send(result)
 
 				<-goroutineSem // Release the slot
 			}(fb2)
 		}
 
-		bar.Finish()
+		wg.Wait() // The books are read from r, wait before closing it
 		r.Close()
+
+		// Wait for the archive to be written, so that its stats are printed
+		// before the next one starts.
+		flushed := make(chan struct{})
+		writer.send(bookResult{seq: nextSeq(), archive: archive, end: true, complete: running.Err() == nil, flushed: flushed})
+		<-flushed
 	}
 
-	wg.Wait() // Wait for all goroutines to complete
+	writeErr := writer.Close()
+	if err := out.Close(); err != nil && writeErr == nil {
+		writeErr = fmt.Errorf("error writing %s: %w", outputCSVPath, err)
+	}
+	if err := f.Close(); err != nil && writeErr == nil {
+		writeErr = fmt.Errorf("error writing %s: %w", outputCSVPath, err)
+	}
+	if writeErr != nil {
+		log.Println("Aborted:", writeErr)
+		fmt.Fprintln(os.Stderr, "Aborted:", writeErr)
+		os.Exit(1)
+	}
+
+	if interrupted.Err() != nil {
+		fmt.Println("Interrupted, run again with -resume to continue")
+		log.Println("Interrupted")
+	}
+
+	// Archives go into the manifest once the shard is complete.
+	if manifest != nil {
+		for _, file := range zipFiles {
+			if checkpoint.ArchiveDone(file) {
+				if err := manifest.Record(file, fingerprint, outputCSVPath); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+		if interrupted.Err() == nil {
+			manifest.PendingShard = ""
+		}
+		if err := manifest.Save(); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	f.Close()
+	report.Total.Print(log.Writer(), "total")
+	report.Total.Print(os.Stdout, "total")
+	if report.FailedArchives > 0 {
+		log.Printf("%d archives could not be opened\n", report.FailedArchives)
+		fmt.Printf("%d archives could not be opened, see %s\n", report.FailedArchives, reportPath)
+	}
+	unknownGenres.Print(log.Writer())
+
+	if err := report.Save(reportPath); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,171 @@
+// Package bow turns texts into bags of words and TF-IDF vectors over a
+// vocabulary chosen by document frequency, and writes them as sparse
+// matrices in the SVMlight and MatrixMarket formats, which scipy and
+// scikit-learn load.
+package bow
+
+import (
+	"ArchiveProcessor/stem"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Terms returns the words of text, lower-cased and with ё read as е. Words
+// are runs of letters, joined by hyphens as in "кто-то". With stemming,
+// Cyrillic words are replaced by their stems.
+func Terms(text string, stemming bool) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '-'
+	})
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.Trim(word, "-")
+		if word == "" {
+			continue
+		}
+		word = strings.ReplaceAll(word, "ё", "е")
+		if stemming && isCyrillic(word) {
+			word = stem.Russian(word)
+		}
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+func isCyrillic(word string) bool {
+	for _, r := range word {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Counter counts the documents each term is found in.
+type Counter struct {
+	Docs int
+	DF   map[string]int
+}
+
+// NewCounter returns an empty counter.
+func NewCounter() *Counter {
+	return &Counter{DF: make(map[string]int)}
+}
+
+// Add counts a document.
+func (c *Counter) Add(terms []string) {
+	c.Docs++
+	seen := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			c.DF[term]++
+		}
+	}
+}
+
+// Cutoffs select the terms of a vocabulary, like the arguments of the same
+// names of scikit-learn's TfidfVectorizer.
+type Cutoffs struct {
+	// MinDF is the number of documents a term must be found in.
+	MinDF int
+	// MaxDF is the largest fraction of the documents a term may be found
+	// in, 0 for no limit. Terms found almost everywhere, such as "и" or
+	// "не", say little about a book.
+	MaxDF float64
+	// MaxFeatures keeps that many of the most frequent terms, 0 for all.
+	MaxFeatures int
+}
+
+// Validate checks the ranges of the cutoffs.
+func (c Cutoffs) Validate() error {
+	if c.MinDF < 0 {
+		return fmt.Errorf("min_df %d is negative", c.MinDF)
+	}
+	if c.MaxDF < 0 || c.MaxDF > 1 {
+		return fmt.Errorf("max_df %g is not a fraction", c.MaxDF)
+	}
+	if c.MaxFeatures < 0 {
+		return fmt.Errorf("max_features %d is negative", c.MaxFeatures)
+	}
+	return nil
+}
+
+// Vocabulary maps terms to columns, in alphabetical order, and their inverse
+// document frequencies.
+type Vocabulary struct {
+	Terms []string
+	IDF   []float64
+	index map[string]int
+}
+
+// Vocabulary returns the terms that pass the cutoffs. The inverse document
+// frequency of a term is ln((1+n)/(1+df))+1, as with smooth_idf.
+func (c *Counter) Vocabulary(cutoffs Cutoffs) *Vocabulary {
+	maxDF := float64(c.Docs)
+	if cutoffs.MaxDF > 0 {
+		maxDF = cutoffs.MaxDF * float64(c.Docs)
+	}
+	var terms []string
+	for term, df := range c.DF {
+		if df >= cutoffs.MinDF && float64(df) <= maxDF {
+			terms = append(terms, term)
+		}
+	}
+	if cutoffs.MaxFeatures > 0 && len(terms) > cutoffs.MaxFeatures {
+		sort.Slice(terms, func(i, j int) bool {
+			a, b := c.DF[terms[i]], c.DF[terms[j]]
+			return a > b || a == b && terms[i] < terms[j]
+		})
+		terms = terms[:cutoffs.MaxFeatures]
+	}
+	sort.Strings(terms)
+
+	v := &Vocabulary{Terms: terms, IDF: make([]float64, len(terms)), index: make(map[string]int, len(terms))}
+	for i, term := range terms {
+		v.index[term] = i
+		v.IDF[i] = math.Log(float64(1+c.Docs)/float64(1+c.DF[term])) + 1
+	}
+	return v
+}
+
+// Entry is a non-zero value of a row.
+type Entry struct {
+	Column int
+	Value  float64
+}
+
+// TFIDF returns the TF-IDF vector of a document, by column and normalized to
+// unit length. Terms outside the vocabulary are left out. With sublinear,
+// a term found n times counts 1+ln(n) rather than n.
+func (v *Vocabulary) TFIDF(terms []string, sublinear bool) []Entry {
+	counts := make(map[int]int)
+	for _, term := range terms {
+		if i, ok := v.index[term]; ok {
+			counts[i]++
+		}
+	}
+	row := make([]Entry, 0, len(counts))
+	for i, n := range counts {
+		tf := float64(n)
+		if sublinear {
+			tf = 1 + math.Log(tf)
+		}
+		row = append(row, Entry{Column: i, Value: tf * v.IDF[i]})
+	}
+	// Summed in column order, so that the values don't depend on the order
+	// of the map.
+	sort.Slice(row, func(i, j int) bool { return row[i].Column < row[j].Column })
+	norm := 0.0
+	for _, e := range row {
+		norm += e.Value * e.Value
+	}
+	norm = math.Sqrt(norm)
+	for i := range row {
+		row[i].Value /= norm
+	}
+	return row
+}
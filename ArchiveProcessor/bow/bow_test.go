@@ -0,0 +1,90 @@
+package bow
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerms(t *testing.T) {
+	assert.Equal(t, []string{"ежик", "кто-то", "и", "в", "tea"},
+		Terms("Ёжик, кто-то — и в 1990 -- Tea!", false))
+	assert.Equal(t, []string{"важн", "важн", "книг", "tea"},
+		Terms("Важная, важнейшие книги; Tea", true))
+}
+
+func counter(docs ...string) *Counter {
+	c := NewCounter()
+	for _, doc := range docs {
+		c.Add(Terms(doc, false))
+	}
+	return c
+}
+
+func TestVocabulary(t *testing.T) {
+	c := counter("а б в", "а б", "а г г")
+	assert.Equal(t, 3, c.Docs)
+	assert.Equal(t, 1, c.DF["г"])
+
+	assert.Equal(t, []string{"а", "б", "в", "г"}, c.Vocabulary(Cutoffs{}).Terms)
+	assert.Equal(t, []string{"а", "б"}, c.Vocabulary(Cutoffs{MinDF: 2}).Terms)
+	assert.Equal(t, []string{"б", "в", "г"}, c.Vocabulary(Cutoffs{MaxDF: 0.7}).Terms)
+	assert.Equal(t, []string{"а", "б"}, c.Vocabulary(Cutoffs{MaxFeatures: 2}).Terms)
+
+	assert.NoError(t, Cutoffs{MinDF: 2, MaxDF: 0.5}.Validate())
+	assert.Error(t, Cutoffs{MaxDF: 2}.Validate())
+	assert.Error(t, Cutoffs{MinDF: -1}.Validate())
+}
+
+func TestTFIDF(t *testing.T) {
+	v := counter("а б в", "а б", "а г г").Vocabulary(Cutoffs{})
+	// As TfidfVectorizer(token_pattern=r"\S+").fit_transform gives.
+	idf := func(df float64) float64 { return math.Log(4/(1+df)) + 1 }
+	assert.InDelta(t, 1, v.IDF[0], 1e-12)
+	assert.InDelta(t, idf(2), v.IDF[1], 1e-12)
+
+	row := v.TFIDF(Terms("г а г ж", false), false)
+	assert.Len(t, row, 2)
+	assert.Equal(t, []int{0, 3}, []int{row[0].Column, row[1].Column})
+	n := math.Hypot(1, 2*idf(1))
+	assert.InDelta(t, 1/n, row[0].Value, 1e-12)
+	assert.InDelta(t, 2*idf(1)/n, row[1].Value, 1e-12)
+
+	row = v.TFIDF(Terms("г а г", false), true)
+	n = math.Hypot(1, (1+math.Ln2)*idf(1))
+	assert.InDelta(t, 1/n, row[0].Value, 1e-12)
+
+	assert.Empty(t, v.TFIDF(Terms("ж", false), false))
+}
+
+func writeMatrix(t *testing.T, format string) string {
+	path := filepath.Join(t.TempDir(), "m")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	w, err := NewMatrixWriter(format, f, 4)
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteRow(1, []Entry{{0, 0.6}, {3, 0.8}}))
+	assert.NoError(t, w.WriteRow(0, nil))
+	assert.NoError(t, w.WriteRow(2, []Entry{{2, 1}}))
+	assert.NoError(t, w.Close())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestMatrixWriters(t *testing.T) {
+	assert.Equal(t, "1 1:0.6 4:0.8\n0\n2 3:1\n", writeMatrix(t, "svmlight"))
+
+	lines := strings.Split(writeMatrix(t, "mm"), "\n")
+	assert.Equal(t, "%%MatrixMarket matrix coordinate real general", lines[0])
+	assert.Equal(t, "3 4 3", strings.TrimSpace(lines[1]))
+	assert.Equal(t, []string{"1 1 0.6", "1 4 0.8", "3 3 1", ""}, lines[2:])
+
+	_, err := NewMatrixWriter("csv", nil, 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,120 @@
+package bow
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MatrixWriter writes the rows of a sparse matrix. It is not safe for
+// concurrent use.
+type MatrixWriter interface {
+	// WriteRow writes a row with its label, which only SVMlight keeps.
+	WriteRow(label int, row []Entry) error
+	// Close writes what is buffered. It does not close the underlying
+	// writer.
+	Close() error
+}
+
+// MatrixFormats are the names accepted by NewMatrixWriter.
+var MatrixFormats = []string{"svmlight", "mm"}
+
+// NewMatrixWriter returns a writer of format to w for a matrix of columns
+// columns. "svmlight" is read by sklearn.datasets.load_svmlight_file, "mm",
+// MatrixMarket, by scipy.io.mmread.
+func NewMatrixWriter(format string, w io.WriteSeeker, columns int) (MatrixWriter, error) {
+	switch format {
+	case "svmlight":
+		return &svmLight{w: bufio.NewWriter(w)}, nil
+	case "mm":
+		return newMatrixMarket(w, columns)
+	}
+	return nil, fmt.Errorf("unknown matrix format %q, want one of %s", format, strings.Join(MatrixFormats, ", "))
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+// svmLight writes a line per row, "label column:value ...", with columns
+// counted from 1.
+type svmLight struct {
+	w *bufio.Writer
+}
+
+func (s *svmLight) WriteRow(label int, row []Entry) error {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(label))
+	for _, e := range row {
+		fmt.Fprintf(&b, " %d:%s", e.Column+1, formatValue(e.Value))
+	}
+	b.WriteByte('\n')
+	_, err := s.w.WriteString(b.String())
+	return err
+}
+
+func (s *svmLight) Close() error {
+	return s.w.Flush()
+}
+
+// sizeWidth is the width the size line of a MatrixMarket file is padded to,
+// so that it can be filled in once the rows are written.
+const sizeWidth = 64
+
+// matrixMarket writes the coordinate format: a header, a size line "rows
+// columns entries" and a line "row column value" per entry, counted from 1.
+type matrixMarket struct {
+	w       io.WriteSeeker
+	buf     *bufio.Writer
+	sizeAt  int64
+	columns int
+	rows    int
+	entries int
+}
+
+func newMatrixMarket(w io.WriteSeeker, columns int) (*matrixMarket, error) {
+	sizeAt, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	m := &matrixMarket{w: w, buf: bufio.NewWriter(w), columns: columns}
+	m.buf.WriteString("%%MatrixMarket matrix coordinate real general\n")
+	m.sizeAt = sizeAt + int64(m.buf.Buffered())
+	m.buf.WriteString(m.sizeLine())
+	return m, nil
+}
+
+func (m *matrixMarket) sizeLine() string {
+	return fmt.Sprintf("%-*s\n", sizeWidth-1, fmt.Sprintf("%d %d %d", m.rows, m.columns, m.entries))
+}
+
+func (m *matrixMarket) WriteRow(_ int, row []Entry) error {
+	m.rows++
+	for _, e := range row {
+		if _, err := fmt.Fprintf(m.buf, "%d %d %s\n", m.rows, e.Column+1, formatValue(e.Value)); err != nil {
+			return err
+		}
+		m.entries++
+	}
+	return nil
+}
+
+func (m *matrixMarket) Close() error {
+	if err := m.buf.Flush(); err != nil {
+		return err
+	}
+	end, err := m.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := m.w.Seek(m.sizeAt, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(m.w, m.sizeLine()); err != nil {
+		return err
+	}
+	_, err = m.w.Seek(end, io.SeekStart)
+	return err
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// checkpointEntry is a line of the checkpoint file. A line with an entry
+// marks a book as handled, whether it was accepted or not, a line with Done
+// set marks the whole archive.
+type checkpointEntry struct {
+	Archive string `json:"archive"`
+	Entry   string `json:"entry,omitempty"`
+	Done    bool   `json:"done,omitempty"`
+}
+
+// Checkpoint records the progress of a run, so that an interrupted run can be
+// resumed. It is an append-only file of JSON lines, a crash can at worst
+// leave the last line incomplete. It is safe for concurrent use.
+type Checkpoint struct {
+	mu       sync.Mutex
+	f        *os.File
+	archives map[string]bool
+	entries  map[string]map[string]bool
+}
+
+// OpenCheckpoint opens the checkpoint file at path. With resume set the
+// recorded progress is read back, otherwise the file is started afresh.
+func OpenCheckpoint(path string, resume bool) (*Checkpoint, error) {
+	c := &Checkpoint{archives: make(map[string]bool), entries: make(map[string]map[string]bool)}
+	if !resume {
+		f, err := os.Create(path)
+		c.f = f
+		return c, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	data = completeLines(data)
+	for n, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var e checkpointEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("checkpoint %s line %d: %w", path, n+1, err)
+		}
+		c.mark(e)
+	}
+
+	// Drop an incomplete last line before appending.
+	if err := truncate(path, int64(len(data))); err != nil {
+		return nil, err
+	}
+	c.f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	return c, err
+}
+
+func (c *Checkpoint) mark(e checkpointEntry) {
+	if e.Done {
+		c.archives[e.Archive] = true
+		return
+	}
+	if c.entries[e.Archive] == nil {
+		c.entries[e.Archive] = make(map[string]bool)
+	}
+	c.entries[e.Archive][e.Entry] = true
+}
+
+// ArchiveDone reports whether all books of an archive were handled.
+func (c *Checkpoint) ArchiveDone(archive string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.archives[archive]
+}
+
+// EntryDone reports whether a book was handled.
+func (c *Checkpoint) EntryDone(archive, entry string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.archives[archive] || c.entries[archive][entry]
+}
+
+// MarkEntry records a book as handled. Its record, if any, must have been
+// written before.
+func (c *Checkpoint) MarkEntry(archive, entry string) error {
+	return c.append(checkpointEntry{Archive: archive, Entry: entry})
+}
+
+// MarkArchive records an archive as handled.
+func (c *Checkpoint) MarkArchive(archive string) error {
+	return c.append(checkpointEntry{Archive: archive, Done: true})
+}
+
+func (c *Checkpoint) append(e checkpointEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mark(e)
+	_, err = c.f.Write(append(data, '\n'))
+	return err
+}
+
+func (c *Checkpoint) Close() error {
+	return c.f.Close()
+}
+
+// completeLines returns data up to and including its last newline.
+func completeLines(data []byte) []byte {
+	return data[:bytes.LastIndexByte(data, '\n')+1]
+}
+
+func truncate(path string, size int64) error {
+	err := os.Truncate(path, size)
+	if os.IsNotExist(err) {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	return err
+}
+
+// ResumeOutput prepares the output of an interrupted run for appending: an
+// incomplete last record is cut off, and the IDs of the complete ones are
+// returned so that they are not written again.
+func ResumeOutput(path string) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var size int64
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Whatever follows the last newline was cut off mid-write.
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		size += int64(len(line))
+
+		var record struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("output %s line %d: %w", path, n, err)
+		}
+		ids[record.ID] = true
+	}
+
+	return ids, truncate(path, size)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.checkpoint")
+	c, err := OpenCheckpoint(path, false)
+	assert.NoError(t, err)
+	assert.NoError(t, c.MarkEntry("a.zip", "1.fb2"))
+	assert.NoError(t, c.MarkArchive("a.zip"))
+	assert.NoError(t, c.MarkEntry("b.zip", "1.fb2"))
+	assert.True(t, c.EntryDone("b.zip", "1.fb2"))
+	assert.NoError(t, c.Close())
+
+	// A crash in the middle of a line.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	f.WriteString(`{"archive":"b.zip","ent`)
+	f.Close()
+
+	c, err = OpenCheckpoint(path, true)
+	assert.NoError(t, err)
+	assert.True(t, c.ArchiveDone("a.zip"))
+	assert.True(t, c.EntryDone("a.zip", "2.fb2"))
+	assert.False(t, c.ArchiveDone("b.zip"))
+	assert.True(t, c.EntryDone("b.zip", "1.fb2"))
+	assert.False(t, c.EntryDone("b.zip", "2.fb2"))
+	assert.NoError(t, c.MarkEntry("b.zip", "2.fb2"))
+	assert.NoError(t, c.Close())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"archive":"a.zip","entry":"1.fb2"}
+{"archive":"a.zip","done":true}
+{"archive":"b.zip","entry":"1.fb2"}
+{"archive":"b.zip","entry":"2.fb2"}
+`, string(data))
+
+	// Without resume the progress is dropped.
+	c, err = OpenCheckpoint(path, false)
+	assert.NoError(t, err)
+	assert.False(t, c.ArchiveDone("a.zip"))
+	c.Close()
+}
+
+func TestCheckpointMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.checkpoint")
+	c, err := OpenCheckpoint(path, true)
+	assert.NoError(t, err)
+	assert.False(t, c.EntryDone("a.zip", "1.fb2"))
+	assert.NoError(t, c.MarkEntry("a.zip", "1.fb2"))
+	assert.NoError(t, c.Close())
+}
+
+func TestResumeOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.jsonl")
+	ids, err := ResumeOutput(path)
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+
+	complete := `{"id":"a.zip/1.fb2","body":"x"}` + "\n" + `{"id":"a.zip/2.fb2","body":"y"}` + "\n"
+	assert.NoError(t, os.WriteFile(path, []byte(complete+`{"id":"a.zip/3.fb2","bo`), 0644))
+	ids, err = ResumeOutput(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a.zip/1.fb2": true, "a.zip/2.fb2": true}, ids)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, complete, string(data))
+
+	assert.NoError(t, os.WriteFile(path, []byte("not json\n"), 0644))
+	_, err = ResumeOutput(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,143 @@
+package fb2
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Binary is an attachment stored in a <binary> element, usually an image
+// referenced from the cover page or the text.
+type Binary struct {
+	ID          string
+	ContentType string
+	Data        []byte
+}
+
+func (b *Binary) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	b.ID = attr(start, "id")
+	b.ContentType = attr(start, "content-type")
+
+	var encoded string
+	if err := d.DecodeElement(&encoded, &start); err != nil {
+		return err
+	}
+
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return fmt.Errorf("error decoding binary %s: %w", b.ID, err)
+	}
+	b.Data = data
+	return nil
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		// Some books drop the padding.
+		return base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	}
+	return data, nil
+}
+
+// Size returns the decoded size of the binary in bytes.
+func (b *Binary) Size() int {
+	return len(b.Data)
+}
+
+// IsImage reports whether the binary has an image content type.
+func (b *Binary) IsImage() bool {
+	return strings.HasPrefix(b.ContentType, "image/")
+}
+
+// FileName returns a file name for the binary built from its id, with an
+// extension matching the content type if the id has none.
+func (b *Binary) FileName() string {
+	name := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(b.ID)
+	if name == "" {
+		name = "binary"
+	}
+	if filepath.Ext(name) != "" {
+		return name
+	}
+
+	switch b.ContentType {
+	case "image/jpeg", "image/jpg":
+		return name + ".jpg"
+	case "image/png":
+		return name + ".png"
+	case "image/gif":
+		return name + ".gif"
+	}
+	if exts, err := mime.ExtensionsByType(b.ContentType); err == nil && len(exts) > 0 {
+		return name + exts[0]
+	}
+	return name + ".bin"
+}
+
+// Binary returns the binary with the given id, or nil. A leading "#", as in
+// image hrefs, is ignored.
+func (book *FictionBook) Binary(id string) *Binary {
+	id = strings.TrimPrefix(id, "#")
+	for i := range book.Binaries {
+		if book.Binaries[i].ID == id {
+			return &book.Binaries[i]
+		}
+	}
+	return nil
+}
+
+// Cover returns the binary referenced by the first cover page image, or nil
+// if the book has no cover or it was not parsed.
+func (book *FictionBook) Cover() *Binary {
+	images := book.Description.TitleInfo.CoverPage.Images
+	if len(images) == 0 || images[0].Href == "" {
+		return nil
+	}
+	return book.Binary(images[0].Href)
+}
+
+// WriteImages writes the cover, or with coversOnly unset every image
+// attachment, to dir and returns the paths of the written files.
+func (book *FictionBook) WriteImages(dir string, coversOnly bool) ([]string, error) {
+	var images []*Binary
+	if coversOnly {
+		if cover := book.Cover(); cover != nil {
+			images = append(images, cover)
+		}
+	} else {
+		for i := range book.Binaries {
+			if book.Binaries[i].IsImage() {
+				images = append(images, &book.Binaries[i])
+			}
+		}
+	}
+	if len(images) == 0 {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(images))
+	for _, img := range images {
+		path := filepath.Join(dir, img.FileName())
+		if err := os.WriteFile(path, img.Data, 0644); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,65 @@
+package fb2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCover(t *testing.T) {
+	data, err := os.ReadFile("testdata/177692.fb2")
+	assert.NoError(t, err)
+	book, err := ParseFictionBook(data)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(book.Binaries))
+	cover := book.Cover()
+	assert.NotNil(t, cover)
+	assert.Equal(t, "cover.jpg", cover.ID)
+	assert.Equal(t, "image/jpeg", cover.ContentType)
+	assert.True(t, cover.IsImage())
+	// JPEG magic number
+	assert.Equal(t, []byte{0xFF, 0xD8, 0xFF}, cover.Data[:3])
+	assert.Equal(t, len(cover.Data), cover.Size())
+	assert.Nil(t, book.Binary("#missing"))
+}
+
+func TestParseFictionBookReaderSkipsBinaries(t *testing.T) {
+	f, err := os.Open("testdata/177692.fb2")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	book, err := ParseFictionBookReader(f, ReaderOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, book.Binaries)
+	assert.Nil(t, book.Cover())
+}
+
+func TestBinaryFileName(t *testing.T) {
+	assert.Equal(t, "cover.jpg", (&Binary{ID: "cover.jpg", ContentType: "image/png"}).FileName())
+	assert.Equal(t, "img1.png", (&Binary{ID: "img1", ContentType: "image/png"}).FileName())
+	assert.Equal(t, "_etc_passwd.bin", (&Binary{ID: "/etc/passwd"}).FileName())
+}
+
+func TestWriteImages(t *testing.T) {
+	book := &FictionBook{Binaries: []Binary{
+		{ID: "cover", ContentType: "image/jpeg", Data: []byte("cover")},
+		{ID: "pic.png", ContentType: "image/png", Data: []byte("pic")},
+		{ID: "font", ContentType: "application/octet-stream", Data: []byte("font")},
+	}}
+	book.Description.TitleInfo.CoverPage.Images = []Image{{Href: "#cover"}}
+
+	dir := t.TempDir()
+	paths, err := book.WriteImages(dir, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "cover.jpg")}, paths)
+
+	paths, err = book.WriteImages(filepath.Join(dir, "all"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(paths))
+	data, err := os.ReadFile(paths[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "pic", string(data))
+}
@@ -0,0 +1,580 @@
+package fb2
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// XLinkNamespace is the namespace of the l:href attribute used by images and
+// links.
+const XLinkNamespace = "http://www.w3.org/1999/xlink"
+
+// Block is a block-level element of a section, epigraph, cite or annotation:
+// *Paragraph, *Subtitle, *EmptyLine, *Poem, *Cite, *Table or *Image.
+type Block interface {
+	// Lines returns the text of the block, one entry per paragraph or verse.
+	Lines() []string
+
+	lines(r *renderer) []string
+}
+
+type Body struct {
+	Name      string
+	Image     *Image
+	Title     Title
+	Epigraphs []Epigraph
+	Sections  []Section
+}
+
+type Title struct {
+	// Blocks are the *Paragraph and *EmptyLine elements of the title. An
+	// empty line breaks the title like any paragraph does.
+	Blocks []Block
+
+	// Content is the plain text of the paragraphs, one entry each.
+	Content []string
+}
+
+type Section struct {
+	ID         string
+	Title      Title
+	Epigraphs  []Epigraph
+	Image      *Image
+	Annotation *Annotation
+
+	// A section holds either nested sections or blocks, never both.
+	Sections []Section
+	Blocks   []Block
+
+	// Content is the text of the section's own <p> elements, kept for
+	// callers that only care about plain paragraphs.
+	Content []string
+}
+
+type Paragraph struct {
+	ID      string
+	Style   string
+	Inlines []Inline
+}
+
+type Subtitle struct {
+	Paragraph
+}
+
+type EmptyLine struct{}
+
+type Epigraph struct {
+	ID          string
+	Blocks      []Block
+	TextAuthors []Paragraph
+}
+
+type Cite struct {
+	ID          string
+	Blocks      []Block
+	TextAuthors []Paragraph
+}
+
+type Poem struct {
+	ID          string
+	Title       *Title
+	Epigraphs   []Epigraph
+	Stanzas     []Stanza
+	TextAuthors []Paragraph
+	Date        string
+}
+
+type Stanza struct {
+	Title    *Title
+	Subtitle *Subtitle
+	Verses   []Paragraph
+}
+
+type Table struct {
+	ID   string
+	Rows []TableRow
+}
+
+type TableRow struct {
+	Cells []TableCell
+}
+
+type TableCell struct {
+	Paragraph
+	Header  bool
+	ColSpan string
+	RowSpan string
+}
+
+type Image struct {
+	Href  string `xml:"http://www.w3.org/1999/xlink href,attr"`
+	Alt   string `xml:"alt,attr"`
+	Title string `xml:"title,attr"`
+	ID    string `xml:"id,attr"`
+}
+
+func attr(start xml.StartElement, local string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// decodeChildren calls fn for every child element of start and consumes the
+// matching end element. Children fn does not handle are skipped.
+func decodeChildren(d *xml.Decoder, fn func(xml.StartElement) (bool, error)) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			handled, err := fn(t)
+			if err != nil {
+				return err
+			}
+			if !handled {
+				if err := d.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// decodeBlock decodes a block-level element. It reports false if t is not a
+// block element.
+func decodeBlock(d *xml.Decoder, t xml.StartElement) (Block, bool, error) {
+	var b Block
+	switch t.Name.Local {
+	case "p":
+		b = &Paragraph{}
+	case "subtitle":
+		b = &Subtitle{}
+	case "empty-line":
+		b = &EmptyLine{}
+	case "poem":
+		b = &Poem{}
+	case "cite":
+		b = &Cite{}
+	case "table":
+		b = &Table{}
+	case "image":
+		b = &Image{}
+	default:
+		return nil, false, nil
+	}
+
+	if err := d.DecodeElement(b, &t); err != nil {
+		return nil, true, err
+	}
+	return b, true, nil
+}
+
+func (b *Body) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return b.decode(d, start, nil)
+}
+
+func (b *Body) decode(d *xml.Decoder, start xml.StartElement, budget *textBudget) error {
+	b.Name = attr(start, "name")
+	return decodeChildren(d, func(t xml.StartElement) (bool, error) {
+		switch t.Name.Local {
+		case "image":
+			b.Image = &Image{}
+			return true, d.DecodeElement(b.Image, &t)
+		case "title":
+			if err := d.DecodeElement(&b.Title, &t); err != nil {
+				return true, err
+			}
+			return true, budget.spend(b.Title.Lines())
+		case "epigraph":
+			var e Epigraph
+			if err := d.DecodeElement(&e, &t); err != nil {
+				return true, err
+			}
+			b.Epigraphs = append(b.Epigraphs, e)
+			return true, budget.spend(e.Lines())
+		case "section":
+			// Keep a partially decoded section when the budget runs out.
+			var s Section
+			err := s.decode(d, t, budget)
+			b.Sections = append(b.Sections, s)
+			return true, err
+		}
+		return false, nil
+	})
+}
+
+func (s *Section) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return s.decode(d, start, nil)
+}
+
+func (s *Section) decode(d *xml.Decoder, start xml.StartElement, budget *textBudget) error {
+	s.ID = attr(start, "id")
+	return decodeChildren(d, func(t xml.StartElement) (bool, error) {
+		switch t.Name.Local {
+		case "title":
+			if err := d.DecodeElement(&s.Title, &t); err != nil {
+				return true, err
+			}
+			return true, budget.spend(s.Title.Lines())
+		case "epigraph":
+			var e Epigraph
+			if err := d.DecodeElement(&e, &t); err != nil {
+				return true, err
+			}
+			s.Epigraphs = append(s.Epigraphs, e)
+			return true, budget.spend(e.Lines())
+		case "annotation":
+			s.Annotation = &Annotation{}
+			if err := d.DecodeElement(s.Annotation, &t); err != nil {
+				return true, err
+			}
+			return true, budget.spend(s.Annotation.Lines())
+		case "section":
+			var sub Section
+			err := sub.decode(d, t, budget)
+			s.Sections = append(s.Sections, sub)
+			return true, err
+		case "image":
+			// An image before any other content belongs to the section
+			// header, later ones are part of the text.
+			if s.Image == nil && len(s.Blocks) == 0 && len(s.Sections) == 0 {
+				s.Image = &Image{}
+				return true, d.DecodeElement(s.Image, &t)
+			}
+		}
+
+		b, ok, err := decodeBlock(d, t)
+		if !ok || err != nil {
+			return ok, err
+		}
+		s.Blocks = append(s.Blocks, b)
+		if p, isParagraph := b.(*Paragraph); isParagraph {
+			s.Content = append(s.Content, p.PlainText())
+		}
+		return true, budget.spend(b.Lines())
+	})
+}
+
+// Lines returns the text of the section and all its subsections in document
+// order, one entry per paragraph, title line or verse.
+func (s *Section) Lines() []string {
+	return s.lines(nil)
+}
+
+func (s *Section) lines(r *renderer) []string {
+	lines := s.Title.lines(r)
+	for _, e := range s.Epigraphs {
+		lines = append(lines, e.lines(r)...)
+	}
+	if s.Annotation != nil {
+		lines = append(lines, s.Annotation.lines(r)...)
+	}
+	for i := range s.Sections {
+		lines = append(lines, s.Sections[i].lines(r)...)
+	}
+	for _, b := range s.Blocks {
+		lines = append(lines, b.lines(r)...)
+	}
+	return lines
+}
+
+// Lines returns the text of the body title, epigraphs and sections.
+func (b *Body) Lines() []string {
+	return b.lines(nil)
+}
+
+func (b *Body) lines(r *renderer) []string {
+	lines := b.Title.lines(r)
+	for _, e := range b.Epigraphs {
+		lines = append(lines, e.lines(r)...)
+	}
+	for i := range b.Sections {
+		lines = append(lines, b.Sections[i].lines(r)...)
+	}
+	return lines
+}
+
+func (t *Title) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeChildren(d, func(e xml.StartElement) (bool, error) {
+		if e.Name.Local != "p" && e.Name.Local != "empty-line" {
+			return false, nil
+		}
+		b, _, err := decodeBlock(d, e)
+		if err != nil {
+			return true, err
+		}
+		t.Blocks = append(t.Blocks, b)
+		if p, isParagraph := b.(*Paragraph); isParagraph {
+			t.Content = append(t.Content, p.PlainText())
+		}
+		return true, nil
+	})
+}
+
+// Lines returns the text of the title, one entry per paragraph.
+func (t *Title) Lines() []string {
+	return t.lines(nil)
+}
+
+func (t *Title) lines(r *renderer) []string {
+	return blockLines(r, t.Blocks, nil)
+}
+
+func (p *Paragraph) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	p.ID = attr(start, "id")
+	p.Style = attr(start, "style")
+
+	inlines, err := decodeInlines(d)
+	if err != nil {
+		return err
+	}
+	p.Inlines = inlines
+	return nil
+}
+
+// PlainText returns the text of the paragraph without inline markup.
+func (p *Paragraph) PlainText() string {
+	return PlainText(p.Inlines)
+}
+
+// Markup returns the text of the paragraph with inline markup rendered as
+// described in Markup.
+func (p *Paragraph) Markup() string {
+	return Markup(p.Inlines)
+}
+
+func (p *Paragraph) Lines() []string {
+	return p.lines(nil)
+}
+
+func (p *Paragraph) lines(r *renderer) []string {
+	return []string{r.text(p)}
+}
+
+func (e *EmptyLine) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return d.Skip()
+}
+
+func (e *EmptyLine) Lines() []string {
+	return nil
+}
+
+func (e *EmptyLine) lines(r *renderer) []string {
+	return nil
+}
+
+func decodeTextAuthor(d *xml.Decoder, t xml.StartElement, authors *[]Paragraph) error {
+	var p Paragraph
+	if err := d.DecodeElement(&p, &t); err != nil {
+		return err
+	}
+	*authors = append(*authors, p)
+	return nil
+}
+
+func (e *Epigraph) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	e.ID = attr(start, "id")
+	return decodeChildren(d, func(t xml.StartElement) (bool, error) {
+		if t.Name.Local == "text-author" {
+			return true, decodeTextAuthor(d, t, &e.TextAuthors)
+		}
+		b, ok, err := decodeBlock(d, t)
+		if ok && err == nil {
+			e.Blocks = append(e.Blocks, b)
+		}
+		return ok, err
+	})
+}
+
+func (e *Epigraph) Lines() []string {
+	return e.lines(nil)
+}
+
+func (e *Epigraph) lines(r *renderer) []string {
+	return blockLines(r, e.Blocks, e.TextAuthors)
+}
+
+func (c *Cite) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	c.ID = attr(start, "id")
+	return decodeChildren(d, func(t xml.StartElement) (bool, error) {
+		if t.Name.Local == "text-author" {
+			return true, decodeTextAuthor(d, t, &c.TextAuthors)
+		}
+		b, ok, err := decodeBlock(d, t)
+		if ok && err == nil {
+			c.Blocks = append(c.Blocks, b)
+		}
+		return ok, err
+	})
+}
+
+func (c *Cite) Lines() []string {
+	return c.lines(nil)
+}
+
+func (c *Cite) lines(r *renderer) []string {
+	return blockLines(r, c.Blocks, c.TextAuthors)
+}
+
+func blockLines(r *renderer, blocks []Block, textAuthors []Paragraph) []string {
+	var lines []string
+	for _, b := range blocks {
+		lines = append(lines, b.lines(r)...)
+	}
+	for i := range textAuthors {
+		lines = append(lines, r.text(&textAuthors[i]))
+	}
+	return lines
+}
+
+func (p *Poem) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	p.ID = attr(start, "id")
+	return decodeChildren(d, func(t xml.StartElement) (bool, error) {
+		switch t.Name.Local {
+		case "title":
+			p.Title = &Title{}
+			return true, d.DecodeElement(p.Title, &t)
+		case "epigraph":
+			var e Epigraph
+			if err := d.DecodeElement(&e, &t); err != nil {
+				return true, err
+			}
+			p.Epigraphs = append(p.Epigraphs, e)
+			return true, nil
+		case "subtitle":
+			// A subtitle between stanzas opens a stanza of its own.
+			st := Stanza{Subtitle: &Subtitle{}}
+			if err := d.DecodeElement(st.Subtitle, &t); err != nil {
+				return true, err
+			}
+			p.Stanzas = append(p.Stanzas, st)
+			return true, nil
+		case "stanza":
+			var st Stanza
+			if err := d.DecodeElement(&st, &t); err != nil {
+				return true, err
+			}
+			p.Stanzas = append(p.Stanzas, st)
+			return true, nil
+		case "text-author":
+			return true, decodeTextAuthor(d, t, &p.TextAuthors)
+		case "date":
+			return true, d.DecodeElement(&p.Date, &t)
+		}
+		return false, nil
+	})
+}
+
+func (p *Poem) Lines() []string {
+	return p.lines(nil)
+}
+
+func (p *Poem) lines(r *renderer) []string {
+	var lines []string
+	if p.Title != nil {
+		lines = append(lines, p.Title.lines(r)...)
+	}
+	for _, e := range p.Epigraphs {
+		lines = append(lines, e.lines(r)...)
+	}
+	for _, st := range p.Stanzas {
+		if st.Title != nil {
+			lines = append(lines, st.Title.lines(r)...)
+		}
+		if st.Subtitle != nil {
+			lines = append(lines, r.text(&st.Subtitle.Paragraph))
+		}
+		for i := range st.Verses {
+			lines = append(lines, r.text(&st.Verses[i]))
+		}
+	}
+	for i := range p.TextAuthors {
+		lines = append(lines, r.text(&p.TextAuthors[i]))
+	}
+	return lines
+}
+
+func (s *Stanza) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeChildren(d, func(t xml.StartElement) (bool, error) {
+		switch t.Name.Local {
+		case "title":
+			s.Title = &Title{}
+			return true, d.DecodeElement(s.Title, &t)
+		case "subtitle":
+			s.Subtitle = &Subtitle{}
+			return true, d.DecodeElement(s.Subtitle, &t)
+		case "v":
+			var v Paragraph
+			if err := d.DecodeElement(&v, &t); err != nil {
+				return true, err
+			}
+			s.Verses = append(s.Verses, v)
+			return true, nil
+		}
+		return false, nil
+	})
+}
+
+func (t *Table) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	t.ID = attr(start, "id")
+	return decodeChildren(d, func(tr xml.StartElement) (bool, error) {
+		if tr.Name.Local != "tr" {
+			return false, nil
+		}
+
+		var row TableRow
+		err := decodeChildren(d, func(td xml.StartElement) (bool, error) {
+			if td.Name.Local != "td" && td.Name.Local != "th" {
+				return false, nil
+			}
+			cell := TableCell{
+				Header:  td.Name.Local == "th",
+				ColSpan: attr(td, "colspan"),
+				RowSpan: attr(td, "rowspan"),
+			}
+			if err := d.DecodeElement(&cell.Paragraph, &td); err != nil {
+				return true, err
+			}
+			row.Cells = append(row.Cells, cell)
+			return true, nil
+		})
+		if err != nil {
+			return true, err
+		}
+		t.Rows = append(t.Rows, row)
+		return true, nil
+	})
+}
+
+// Lines returns one entry per table row with cells separated by tabs.
+func (t *Table) Lines() []string {
+	return t.lines(nil)
+}
+
+func (t *Table) lines(r *renderer) []string {
+	lines := make([]string, 0, len(t.Rows))
+	for _, row := range t.Rows {
+		cells := make([]string, len(row.Cells))
+		for i := range row.Cells {
+			cells[i] = r.text(&row.Cells[i].Paragraph)
+		}
+		lines = append(lines, strings.Join(cells, "\t"))
+	}
+	return lines
+}
+
+func (i *Image) Lines() []string {
+	return nil
+}
+
+func (i *Image) lines(r *renderer) []string {
+	return nil
+}
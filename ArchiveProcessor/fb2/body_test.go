@@ -0,0 +1,143 @@
+package fb2
+
+import (
+	"ArchiveProcessor/normalize"
+	"ArchiveProcessor/window"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const nestedBook = `<?xml version="1.0" encoding="UTF-8"?>
+<FictionBook xmlns:l="http://www.w3.org/1999/xlink" xmlns="http://www.gribuser.ru/xml/fictionbook/2.0">
+<description><title-info><book-title>Тест</book-title></title-info></description>
+<body>
+  <title><p>Книга</p><empty-line/><p>Том 1</p></title>
+  <epigraph><p>Эпиграф книги</p></epigraph>
+  <section id="part1">
+    <title><p>Часть первая</p></title>
+    <section>
+      <title><p>Глава 1</p></title>
+      <p>Первый абзац.</p>
+      <poem>
+        <title><p>Стих</p></title>
+        <stanza>
+          <v>Строка один</v>
+          <v>Строка два</v>
+        </stanza>
+        <text-author>Поэт</text-author>
+      </poem>
+      <empty-line/>
+      <cite>
+        <p>Цитата</p>
+        <text-author>Автор цитаты</text-author>
+      </cite>
+      <subtitle>* * *</subtitle>
+      <table>
+        <tr><th>A</th><th>B</th></tr>
+        <tr><td>1</td><td colspan="2">2</td></tr>
+      </table>
+      <image l:href="#pic.png"/>
+      <p>Последний абзац.</p>
+    </section>
+    <section>
+      <epigraph><p>Эпиграф</p></epigraph>
+      <p>Второй абзац <emphasis>с курсивом</emphasis>.</p>
+    </section>
+  </section>
+</body>
+</FictionBook>`
+
+func TestNestedSections(t *testing.T) {
+	book, err := ParseFictionBook([]byte(nestedBook))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"Книга", "Том 1"}, book.Body.Title.Content)
+	assert.IsType(t, &EmptyLine{}, book.Body.Title.Blocks[1])
+	assert.Equal(t, 1, len(book.Body.Epigraphs))
+	assert.Equal(t, 1, len(book.Body.Sections))
+
+	part := book.Body.Sections[0]
+	assert.Equal(t, "part1", part.ID)
+	assert.Equal(t, 2, len(part.Sections))
+	assert.Empty(t, part.Blocks)
+
+	chapter := part.Sections[0]
+	assert.Equal(t, []string{"Первый абзац.", "Последний абзац."}, chapter.Content)
+	assert.Equal(t, 8, len(chapter.Blocks))
+	assert.IsType(t, &Poem{}, chapter.Blocks[1])
+	assert.IsType(t, &EmptyLine{}, chapter.Blocks[2])
+	assert.IsType(t, &Cite{}, chapter.Blocks[3])
+	assert.IsType(t, &Subtitle{}, chapter.Blocks[4])
+	assert.IsType(t, &Table{}, chapter.Blocks[5])
+	assert.Equal(t, "#pic.png", chapter.Blocks[6].(*Image).Href)
+
+	poem := chapter.Blocks[1].(*Poem)
+	assert.Equal(t, 1, len(poem.Stanzas))
+	assert.Equal(t, "Строка два", poem.Stanzas[0].Verses[1].PlainText())
+	assert.Equal(t, "Поэт", poem.TextAuthors[0].PlainText())
+
+	table := chapter.Blocks[5].(*Table)
+	assert.True(t, table.Rows[0].Cells[0].Header)
+	assert.Equal(t, "2", table.Rows[1].Cells[1].ColSpan)
+
+	second := part.Sections[1]
+	assert.Equal(t, 1, len(second.Epigraphs))
+	assert.Equal(t, []string{"Второй абзац с курсивом."}, second.Content)
+}
+
+func TestSectionLines(t *testing.T) {
+	book, err := ParseFictionBook([]byte(nestedBook))
+	assert.NoError(t, err)
+
+	expected := []string{
+		"Часть первая",
+		"Глава 1",
+		"Первый абзац.",
+		"Стих", "Строка один", "Строка два", "Поэт",
+		"Цитата", "Автор цитаты",
+		"* * *",
+		"A\tB", "1\t2",
+		"Последний абзац.",
+		"Эпиграф",
+		"Второй абзац с курсивом.",
+	}
+	assert.Equal(t, expected, book.Body.Sections[0].Lines())
+	assert.Equal(t, append([]string{"Книга", "Том 1", "Эпиграф книги"}, expected...), book.Body.Lines())
+	// The body title and epigraphs are part of the content.
+	assert.Equal(t, book.Body.Lines(), book.contentLines(NotesDrop))
+}
+
+func TestFlattenIncludesNestedText(t *testing.T) {
+	data, err := os.ReadFile("testbook.xml")
+	assert.NoError(t, err)
+	book, err := ParseFictionBook(data)
+	assert.NoError(t, err)
+
+	flattened := book.Flatten()
+	assert.Contains(t, flattened.Content, "Бернард Шоу")
+	assert.Contains(t, flattened.Content, "Глава 1")
+}
+
+func TestFlattenWindows(t *testing.T) {
+	book := parseTestBook(t, "testdata/177691.fb2")
+
+	flattened := book.Flatten()
+	assert.True(t, utf8.ValidString(flattened.Content))
+	// The text starts with the title of the body.
+	assert.Equal(t, DefaultFlattenRunes, utf8.RuneCountInString(flattened.Content))
+	assert.True(t, strings.HasPrefix(flattened.Content,
+		"Виктор Суворов\nРАЗГРОМ\nТретья книга трилогии ПОСЛЕДНЯЯ РЕСПУБЛИКА\nВМЕСТО ПРЕДИСЛОВИЯ\nУ Гитлера красный флаг."))
+	assert.Equal(t, 57, strings.Count(flattened.Content, "\n"))
+	assert.Equal(t, normalize.Default, flattened.Normalization)
+	assert.Equal(t, []string{flattened.Content}, flattened.Windows)
+
+	flattened = book.FlattenWithOptions(FlattenOptions{
+		Window: window.Config{Strategy: window.Spaced, Unit: window.Words, Size: 50, Count: 3},
+	})
+	assert.Len(t, flattened.Windows, 3)
+	assert.Equal(t, flattened.Windows, strings.Split(flattened.Content, window.Separator))
+}
@@ -0,0 +1,107 @@
+package fb2
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// prologSize is how much of the document is inspected for a BOM and the XML
+// declaration.
+const prologSize = 1024
+
+var prologEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*?encoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// lookupEncoding returns the canonical name and decoder for an encoding
+// label. A nil encoding means the input is already UTF-8.
+func lookupEncoding(label string) (string, encoding.Encoding, error) {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "", "utf-8", "utf8":
+		return "utf-8", nil, nil
+	case "windows-1251", "cp1251", "win-1251", "x-cp1251":
+		return "windows-1251", charmap.Windows1251, nil
+	case "koi8-r", "koi8r", "koi8", "cskoi8r":
+		return "koi8-r", charmap.KOI8R, nil
+	case "cp866", "ibm866", "866", "csibm866":
+		return "cp866", charmap.CodePage866, nil
+	case "iso-8859-5", "iso8859-5", "cyrillic":
+		return "iso-8859-5", charmap.ISO8859_5, nil
+	case "utf-16", "utf-16le", "utf-16be":
+		// UTF-16 is detected from the BOM or the first bytes before the
+		// declaration is read, so by now the text is already UTF-8.
+		return "utf-8", nil, nil
+	}
+
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return "", nil, fmt.Errorf("unsupported encoding %q", label)
+	}
+	name, _ := htmlindex.Name(enc)
+	return name, enc, nil
+}
+
+// CharsetReader converts input in the encoding named by label to UTF-8. It
+// can be used as xml.Decoder.CharsetReader.
+func CharsetReader(label string, input io.Reader) (io.Reader, error) {
+	_, enc, err := lookupEncoding(label)
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil {
+		return input, nil
+	}
+	return transform.NewReader(input, enc.NewDecoder()), nil
+}
+
+// utf8CharsetReader is used by decoders reading the output of
+// NewDecodingReader, which is UTF-8 whatever the declaration says.
+func utf8CharsetReader(label string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
+
+// NewDecodingReader returns a reader producing the document in r as UTF-8,
+// together with the name of the encoding it was stored in. The encoding is
+// taken from the byte order mark, the layout of the first bytes for UTF-16
+// without a BOM, or the encoding attribute of the XML declaration, in that
+// order; UTF-8 is assumed otherwise. A UTF-8 BOM is removed.
+func NewDecodingReader(r io.Reader) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, prologSize)
+	head, err := br.Peek(prologSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		br.Discard(3)
+		return br, "utf-8", nil
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}), bytes.HasPrefix(head, []byte{'<', 0, '?', 0}):
+		dec := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder()
+		return transform.NewReader(br, dec), "utf-16le", nil
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}), bytes.HasPrefix(head, []byte{0, '<', 0, '?'}):
+		dec := unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewDecoder()
+		return transform.NewReader(br, dec), "utf-16be", nil
+	}
+
+	label := "utf-8"
+	if m := prologEncoding.FindSubmatch(head); m != nil {
+		label = string(m[1])
+	}
+	name, enc, err := lookupEncoding(label)
+	if err != nil {
+		return nil, "", err
+	}
+	if enc == nil {
+		return br, name, nil
+	}
+	return transform.NewReader(br, enc.NewDecoder()), name, nil
+}
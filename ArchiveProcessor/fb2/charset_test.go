@@ -0,0 +1,87 @@
+package fb2
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func encodedBook(t *testing.T, label string, enc encoding.Encoding) []byte {
+	doc := `<?xml version="1.0" encoding="` + label + `"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0">
+<description><title-info><book-title>Ёжик в тумане</book-title><lang>ru</lang></title-info></description>
+<body><section><p>Съешь же ещё этих мягких французских булок.</p></section></body>
+</FictionBook>`
+	if enc == nil {
+		return []byte(doc)
+	}
+	data, err := enc.NewEncoder().Bytes([]byte(doc))
+	assert.NoError(t, err)
+	return data
+}
+
+func TestParseEncodings(t *testing.T) {
+	tests := []struct {
+		label    string
+		enc      encoding.Encoding
+		expected string
+	}{
+		{"UTF-8", nil, "utf-8"},
+		{"windows-1251", charmap.Windows1251, "windows-1251"},
+		{"Windows-1251", charmap.Windows1251, "windows-1251"},
+		{"koi8-r", charmap.KOI8R, "koi8-r"},
+		{"cp866", charmap.CodePage866, "cp866"},
+		{"iso-8859-5", charmap.ISO8859_5, "iso-8859-5"},
+		{"utf-16", unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), "utf-16le"},
+		{"utf-16", unicode.UTF16(unicode.BigEndian, unicode.UseBOM), "utf-16be"},
+		{"utf-16", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), "utf-16le"},
+	}
+
+	for _, tt := range tests {
+		book, err := ParseFictionBook(encodedBook(t, tt.label, tt.enc))
+		if !assert.NoError(t, err, tt.expected) {
+			continue
+		}
+		assert.Equal(t, tt.expected, book.Encoding)
+		assert.Equal(t, "Ёжик в тумане", book.Description.TitleInfo.BookTitle, tt.expected)
+		assert.Equal(t, []string{"Съешь же ещё этих мягких французских булок."},
+			book.Body.Sections[0].Content, tt.expected)
+	}
+}
+
+func TestParseStripsUTF8BOM(t *testing.T) {
+	data := append([]byte{0xEF, 0xBB, 0xBF}, encodedBook(t, "utf-8", nil)...)
+	book, err := ParseFictionBook(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "utf-8", book.Encoding)
+	assert.Equal(t, "Ёжик в тумане", book.Description.TitleInfo.BookTitle)
+}
+
+func TestNewDecodingReader(t *testing.T) {
+	r, name, err := NewDecodingReader(bytes.NewReader(encodedBook(t, "koi8-r", charmap.KOI8R)))
+	assert.NoError(t, err)
+	assert.Equal(t, "koi8-r", name)
+
+	text, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Contains(t, string(text), "Ёжик в тумане")
+
+	_, _, err = NewDecodingReader(strings.NewReader(`<?xml version="1.0" encoding="no-such"?><a/>`))
+	assert.Error(t, err)
+}
+
+func TestCharsetReader(t *testing.T) {
+	d := xml.NewDecoder(bytes.NewReader(encodedBook(t, "windows-1251", charmap.Windows1251)))
+	d.CharsetReader = CharsetReader
+
+	var book FictionBook
+	assert.NoError(t, d.Decode(&book))
+	assert.Equal(t, "Ёжик в тумане", book.Description.TitleInfo.BookTitle)
+}
@@ -1,6 +1,9 @@
 package fb2
 
 import (
+	"ArchiveProcessor/normalize"
+	"ArchiveProcessor/window"
+	"bytes"
 	"encoding/xml"
 	"log"
 	"strings"
@@ -10,99 +13,45 @@ type FictionBook struct {
 	XMLName     xml.Name    `xml:"FictionBook"`
 	Description Description `xml:"description"`
 	Body        Body        `xml:"body"`
-}
-
-type Description struct {
-	TitleInfo    TitleInfo    `xml:"title-info"`
-	DocumentInfo DocumentInfo `xml:"document-info"`
-	PublishInfo  PublishInfo  `xml:"publish-info"`
-}
-
-type TitleInfo struct {
-	Genres     []string   `xml:"genre"`
-	Authors    []Author   `xml:"author"`
-	BookTitle  string     `xml:"book-title"`
-	Annotation Annotation `xml:"annotation"`
-	Date       string     `xml:"date"`
-	CoverPage  CoverPage  `xml:"coverpage"`
-	Lang       string     `xml:"lang"`
-	Sequences  []Sequence `xml:"sequence"`
-}
-
-type Author struct {
-	FirstName  string `xml:"first-name"`
-	MiddleName string `xml:"middle-name"`
-	LastName   string `xml:"last-name"`
-	NickName   string `xml:"nick-name"`
-	ID         string `xml:"id"`
-}
-
-type Annotation struct {
-	Content string `xml:"p"`
-}
-
-type CoverPage struct {
-	Image Image `xml:"image"`
-}
-
-type Image struct {
-	Href string `xml:"l:href,attr"`
-}
-
-type Sequence struct {
-	Name string `xml:"name,attr"`
-}
-
-type DocumentInfo struct {
-	Author      Author  `xml:"author"`
-	ProgramUsed string  `xml:"program-used"`
-	Date        string  `xml:"date"`
-	SrcURL      string  `xml:"src-url"`
-	SrcOCR      string  `xml:"src-ocr"`
-	ID          string  `xml:"id"`
-	Version     string  `xml:"version"`
-	History     History `xml:"history"`
-}
-
-type History struct {
-	Content string `xml:"p"`
-}
+	// NoteBodies are the <body> elements following the main one, usually
+	// named "notes" or "comments".
+	NoteBodies []Body   `xml:"-"`
+	Binaries   []Binary `xml:"binary"`
 
-type PublishInfo struct {
-	BookName  string `xml:"book-name"`
-	Publisher string `xml:"publisher"`
-	City      string `xml:"city"`
-	Year      string `xml:"year"`
-	ISBN      string `xml:"isbn"`
-}
-
-type Body struct {
-	Title    Title     `xml:"title"`
-	Sections []Section `xml:"section"`
-}
-
-type Title struct {
-	Content []string `xml:"p"`
-}
+	// Truncated is set by ParseFictionBookReader when it stopped reading
+	// the bodies early.
+	Truncated bool `xml:"-"`
+	// Encoding is the name of the encoding the book was stored in.
+	Encoding string `xml:"-"`
+	// Repairs lists the fixes applied to a malformed book when parsed with
+	// ReaderOptions.Repair, and the binaries dropped with
+	// ReaderOptions.KeepBinaries because they could not be decoded.
+	Repairs []Repair `xml:"-"`
 
-type Section struct {
-	Title   Title    `xml:"title"`
-	Content []string `xml:"p"`
+	notes map[string]*Section
 }
 
 type FlattenedBook struct {
-	Title      string
-	Author     []string
-	Annotation string
-	Sequences  []string
-	Genres     []string
-	Content    string
+	Title           string
+	Author          []string
+	Annotation      string
+	Sequences       []string
+	SequenceNumbers []string
+	Genres          []string
+	Lang            string
+	SrcLang         string
+	Translated      bool
+	// Content is the text of Windows, separated by window.Separator, a
+	// blank line. Paragraphs within a window are on lines of their own.
+	Content string
+	Windows []string
+	// Normalization lists the steps applied to the title, annotation and
+	// content.
+	Normalization normalize.Steps
 }
 
 func ParseFictionBook(data []byte) (*FictionBook, error) {
-	book := &FictionBook{}
-	err := xml.Unmarshal(data, &book)
-
+	book, err := ParseFictionBookReader(bytes.NewReader(data), ReaderOptions{KeepBinaries: true})
 	if err != nil {
 		log.Printf("Error unmarshalling book: %+v", err)
 		return nil, err
@@ -111,34 +60,69 @@ func ParseFictionBook(data []byte) (*FictionBook, error) {
 	return book, nil
 }
 
+// ParseFictionBookLenient parses a book like ParseFictionBook, repairing
+// common breakage first, and returns the fixes applied. See RepairXML.
+func ParseFictionBookLenient(data []byte) (*FictionBook, []Repair, error) {
+	book, err := ParseFictionBookReader(bytes.NewReader(data), ReaderOptions{KeepBinaries: true, Repair: true})
+	if err != nil {
+		log.Printf("Error unmarshalling book: %+v", err)
+		return nil, nil, err
+	}
+
+	return book, book.Repairs, nil
+}
+
+// FlattenOptions controls FlattenWithOptions.
+type FlattenOptions struct {
+	Notes NotesMode
+	// Window selects the content kept, the first DefaultFlattenRunes runes
+	// if unset. Random windows are keyed by the document ID.
+	Window window.Config
+	// Normalize lists the normalization steps, normalize.Default if nil.
+	Normalize normalize.Steps
+}
+
+// DefaultFlattenRunes is the length of the content kept by Flatten.
+const DefaultFlattenRunes = 5000
+
+// Flatten flattens the book leaving out the notes bodies.
 func (book *FictionBook) Flatten() *FlattenedBook {
+	return book.FlattenWithOptions(FlattenOptions{})
+}
+
+func (book *FictionBook) FlattenWithOptions(opts FlattenOptions) *FlattenedBook {
 	flattened := &FlattenedBook{
 		Title:      book.Description.TitleInfo.BookTitle,
 		Annotation: book.Description.TitleInfo.Annotation.Content,
 		Sequences:  make([]string, len(book.Description.TitleInfo.Sequences)),
 		Genres:     book.Description.TitleInfo.Genres,
+		Lang:       book.Description.TitleInfo.Lang,
+		SrcLang:    book.Description.TitleInfo.SrcLang,
+		Translated: book.Description.TitleInfo.IsTranslation(),
 		Content:    "",
 	}
 
+	flattened.SequenceNumbers = make([]string, len(flattened.Sequences))
 	for i, seq := range book.Description.TitleInfo.Sequences {
 		flattened.Sequences[i] = seq.Name
+		flattened.SequenceNumbers[i] = seq.Number
 	}
 
-	for _, section := range book.Body.Sections {
-		if len(section.Title.Content) > 0 {
-			flattened.Content += section.Title.Content[0] + "\n"
-		}
-
-		for _, p := range section.Content {
-			flattened.Content += p + "\n"
-		}
+	flattened.Normalization = opts.Normalize
+	if flattened.Normalization == nil {
+		flattened.Normalization = normalize.Default
 	}
-
-	// Remove all new lines
-	flattened.Content = strings.Replace(flattened.Content, "\n", "", -1)
-	if len(flattened.Content) > 5000 {
-		flattened.Content = flattened.Content[:5000]
+	flattened.Title = flattened.Normalization.Apply(flattened.Title)
+	flattened.Annotation = flattened.Normalization.Apply(flattened.Annotation)
+
+	// Paragraphs are normalized one per line and stay on their own lines.
+	flattened.Content = flattened.Normalization.Apply(strings.Join(book.contentLines(opts.Notes), "\n"))
+	w := opts.Window
+	if w.Size == 0 {
+		w = window.Config{Strategy: window.Head, Unit: window.Runes, Size: DefaultFlattenRunes}
 	}
+	flattened.Windows = w.Windows(flattened.Content, book.Description.DocumentInfo.ID)
+	flattened.Content = strings.Join(flattened.Windows, window.Separator)
 
 	// Flatten authors
 	for _, author := range book.Description.TitleInfo.Authors {
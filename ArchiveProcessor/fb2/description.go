@@ -0,0 +1,199 @@
+package fb2
+
+import (
+	"ArchiveProcessor/langid"
+	"encoding/xml"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Description struct {
+	TitleInfo    TitleInfo    `xml:"title-info"`
+	SrcTitleInfo *TitleInfo   `xml:"src-title-info"`
+	DocumentInfo DocumentInfo `xml:"document-info"`
+	PublishInfo  PublishInfo  `xml:"publish-info"`
+	CustomInfo   []CustomInfo `xml:"custom-info"`
+}
+
+type TitleInfo struct {
+	Genres      []string   `xml:"genre"`
+	Authors     []Author   `xml:"author"`
+	BookTitle   string     `xml:"book-title"`
+	Annotation  Annotation `xml:"annotation"`
+	Keywords    string     `xml:"keywords"`
+	Date        Date       `xml:"date"`
+	CoverPage   CoverPage  `xml:"coverpage"`
+	Lang        string     `xml:"lang"`
+	SrcLang     string     `xml:"src-lang"`
+	Translators []Author   `xml:"translator"`
+	Sequences   []Sequence `xml:"sequence"`
+
+	// GenreMatches holds the match attribute of the genres that have one,
+	// keyed by genre code. The schema default is 100.
+	GenreMatches map[string]int `xml:"-"`
+}
+
+type genre struct {
+	Code  string `xml:",chardata"`
+	Match string `xml:"match,attr"`
+}
+
+func (ti *TitleInfo) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	// The shallower Genres field takes precedence over the embedded one.
+	type titleInfo TitleInfo
+	var raw struct {
+		titleInfo
+		Genres []genre `xml:"genre"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	*ti = TitleInfo(raw.titleInfo)
+	for _, g := range raw.Genres {
+		code := strings.TrimSpace(g.Code)
+		ti.Genres = append(ti.Genres, code)
+		if match, err := strconv.Atoi(strings.TrimSpace(g.Match)); err == nil {
+			if ti.GenreMatches == nil {
+				ti.GenreMatches = make(map[string]int)
+			}
+			ti.GenreMatches[code] = match
+		}
+	}
+	return nil
+}
+
+// IsTranslation reports whether the book is a translation, judging by the
+// translators and the source language. Languages are compared by their
+// primary subtag, so ru-RU is the same language as ru.
+func (ti *TitleInfo) IsTranslation() bool {
+	if len(ti.Translators) > 0 {
+		return true
+	}
+	return ti.SrcLang != "" && langid.NormalizeTag(ti.SrcLang) != langid.NormalizeTag(ti.Lang)
+}
+
+type Author struct {
+	FirstName  string   `xml:"first-name"`
+	MiddleName string   `xml:"middle-name"`
+	LastName   string   `xml:"last-name"`
+	NickName   string   `xml:"nickname"`
+	HomePages  []string `xml:"home-page"`
+	Emails     []string `xml:"email"`
+	ID         string   `xml:"id"`
+}
+
+func (a *Author) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	// Many books spell nickname as nick-name.
+	type author Author
+	var raw struct {
+		author
+		NickName string `xml:"nick-name"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	*a = Author(raw.author)
+	if a.NickName == "" {
+		a.NickName = raw.NickName
+	}
+	return nil
+}
+
+// Annotation holds the content of <annotation> and <history> elements.
+type Annotation struct {
+	ID     string
+	Blocks []Block
+
+	// Content is the plain text of Blocks, one line per paragraph.
+	Content string
+}
+
+func (a *Annotation) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	a.ID = attr(start, "id")
+	err := decodeChildren(d, func(t xml.StartElement) (bool, error) {
+		b, ok, err := decodeBlock(d, t)
+		if ok && err == nil {
+			a.Blocks = append(a.Blocks, b)
+		}
+		return ok, err
+	})
+	a.Content = strings.Join(a.Lines(), "\n")
+	return err
+}
+
+func (a *Annotation) Lines() []string {
+	return a.lines(nil)
+}
+
+func (a *Annotation) lines(r *renderer) []string {
+	return blockLines(r, a.Blocks, nil)
+}
+
+// Date is a date given as free text, with an optional machine-readable value.
+type Date struct {
+	Text  string `xml:",chardata"`
+	Value string `xml:"value,attr"`
+}
+
+var yearPattern = regexp.MustCompile(`(^|[^0-9])([0-9]{4})($|[^0-9])`)
+
+// Year returns the year of the date, taken from the value if it has one and
+// from the text otherwise.
+func (d *Date) Year() (int, bool) {
+	return parseYear(d.Value, d.Text)
+}
+
+// parseYear returns the first four-digit number found in texts.
+func parseYear(texts ...string) (int, bool) {
+	for _, text := range texts {
+		if m := yearPattern.FindStringSubmatch(text); m != nil {
+			year, _ := strconv.Atoi(m[2])
+			return year, true
+		}
+	}
+	return 0, false
+}
+
+type CoverPage struct {
+	Images []Image `xml:"image"`
+}
+
+type Sequence struct {
+	Name      string     `xml:"name,attr"`
+	Number    string     `xml:"number,attr"`
+	Sequences []Sequence `xml:"sequence"`
+}
+
+type DocumentInfo struct {
+	Authors     []Author   `xml:"author"`
+	ProgramUsed string     `xml:"program-used"`
+	Date        Date       `xml:"date"`
+	SrcURLs     []string   `xml:"src-url"`
+	SrcOCR      string     `xml:"src-ocr"`
+	ID          string     `xml:"id"`
+	Version     string     `xml:"version"`
+	History     Annotation `xml:"history"`
+	Publishers  []Author   `xml:"publisher"`
+}
+
+type PublishInfo struct {
+	BookName  string     `xml:"book-name"`
+	Publisher string     `xml:"publisher"`
+	City      string     `xml:"city"`
+	Year      string     `xml:"year"`
+	ISBN      string     `xml:"isbn"`
+	Sequences []Sequence `xml:"sequence"`
+}
+
+// PublishYear returns the year of the publish-info.
+func (pi *PublishInfo) PublishYear() (int, bool) {
+	return parseYear(pi.Year)
+}
+
+type CustomInfo struct {
+	InfoType string `xml:"info-type,attr"`
+	Text     string `xml:",chardata"`
+}
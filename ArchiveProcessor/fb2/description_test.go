@@ -0,0 +1,130 @@
+package fb2
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTranslation(t *testing.T) {
+	for _, c := range []struct {
+		srcLang, lang string
+		expected      bool
+	}{
+		{"", "ru", false},
+		{"ru", "ru", false},
+		{"ru", "ru-RU", false},
+		{"RU_ru", "ru", false},
+		{"rus", "ru", false},
+		{"en", "ru", true},
+		{"en-US", "ru-RU", true},
+	} {
+		ti := TitleInfo{SrcLang: c.srcLang, Lang: c.lang}
+		assert.Equal(t, c.expected, ti.IsTranslation(), "%q %q", c.srcLang, c.lang)
+	}
+}
+
+func TestTitleInfoMetadata(t *testing.T) {
+	book := parseTestBook(t, "testdata/177692.fb2")
+	ti := book.Description.TitleInfo
+
+	assert.Equal(t, "en", ti.SrcLang)
+	assert.Equal(t, 1, len(ti.Translators))
+	assert.Equal(t, "Победимова", ti.Translators[0].LastName)
+	assert.True(t, ti.IsTranslation())
+	assert.Equal(t, []Sequence{{Name: "Братья Харди", Number: "32"}}, ti.Sequences)
+	assert.Equal(t, "#cover.jpg", ti.CoverPage.Images[0].Href)
+
+	di := book.Description.DocumentInfo
+	assert.Equal(t, "Tanja45", di.Authors[0].NickName)
+	assert.Equal(t, []string{"http://lib.rus.ec "}, di.Authors[0].HomePages)
+	assert.Equal(t, Date{Text: "14 January 2010", Value: "2010-01-14"}, di.Date)
+	assert.Equal(t, []string{"http://www.newchapter.ru/"}, di.SrcURLs)
+
+	assert.Equal(t, 1, len(book.Description.CustomInfo))
+	assert.Contains(t, book.Description.CustomInfo[0].Text, "Тираж: 25000 экз.")
+
+	flattened := book.Flatten()
+	assert.Equal(t, []string{"32"}, flattened.SequenceNumbers)
+	assert.Equal(t, "en", flattened.SrcLang)
+	assert.True(t, flattened.Translated)
+}
+
+func TestSrcTitleInfo(t *testing.T) {
+	book := parseTestBook(t, "testdata/177694.fb2")
+
+	src := book.Description.SrcTitleInfo
+	assert.NotNil(t, src)
+	assert.Equal(t, "The Syndic", src.BookTitle)
+	assert.Equal(t, "en", src.Lang)
+	assert.Equal(t, "Kornbluth", src.Authors[0].LastName)
+
+	assert.Nil(t, parseTestBook(t, "testdata/177692.fb2").Description.SrcTitleInfo)
+}
+
+func TestDescriptionDetails(t *testing.T) {
+	data := `<description>
+<title-info>
+  <genre match="80">sf_space</genre><genre> sf </genre>
+  <author><first-name>А</first-name><last-name>Б</last-name><nick-name>ab</nick-name>
+    <email>a@b.c</email><email>d@e.f</email></author>
+  <book-title>Т</book-title>
+  <annotation><p>Первый.</p><empty-line/><p>Второй <emphasis>абзац</emphasis>.</p></annotation>
+  <keywords>космос, роботы</keywords>
+  <date value="2001-01-01">2001</date>
+  <lang>ru</lang>
+</title-info>
+<document-info>
+  <author><nickname>one</nickname></author>
+  <author><nickname>two</nickname></author>
+  <history><p>v1</p><p>v2</p></history>
+</document-info>
+<publish-info><sequence name="Серия" number="5"><sequence name="Подсерия" number="2"/></sequence></publish-info>
+</description>`
+
+	var desc Description
+	assert.NoError(t, xml.Unmarshal([]byte(data), &desc))
+
+	ti := desc.TitleInfo
+	assert.Equal(t, []string{"sf_space", "sf"}, ti.Genres)
+	assert.Equal(t, map[string]int{"sf_space": 80}, ti.GenreMatches)
+	assert.Equal(t, "ab", ti.Authors[0].NickName)
+	assert.Equal(t, []string{"a@b.c", "d@e.f"}, ti.Authors[0].Emails)
+	assert.Equal(t, "Первый.\nВторой абзац.", ti.Annotation.Content)
+	assert.Equal(t, 3, len(ti.Annotation.Blocks))
+	assert.Equal(t, "космос, роботы", ti.Keywords)
+	assert.Equal(t, "2001-01-01", ti.Date.Value)
+	assert.False(t, ti.IsTranslation())
+
+	assert.Equal(t, 2, len(desc.DocumentInfo.Authors))
+	assert.Equal(t, "v1\nv2", desc.DocumentInfo.History.Content)
+
+	seq := desc.PublishInfo.Sequences[0]
+	assert.Equal(t, "5", seq.Number)
+	assert.Equal(t, []Sequence{{Name: "Подсерия", Number: "2"}}, seq.Sequences)
+}
+
+func TestDateYear(t *testing.T) {
+	tests := []struct {
+		date Date
+		year int
+		ok   bool
+	}{
+		{Date{Text: "20.11.2009", Value: "2009-11-20"}, 2009, true},
+		{Date{Text: "1968"}, 1968, true},
+		{Date{Text: "около 1920 г."}, 1920, true},
+		{Date{Text: "12345"}, 0, false},
+		{Date{}, 0, false},
+	}
+	for _, tt := range tests {
+		year, ok := tt.date.Year()
+		assert.Equal(t, tt.year, year, tt.date.Text)
+		assert.Equal(t, tt.ok, ok, tt.date.Text)
+	}
+
+	pi := PublishInfo{Year: "2005 г."}
+	year, ok := pi.PublishYear()
+	assert.Equal(t, 2005, year)
+	assert.True(t, ok)
+}
@@ -0,0 +1,109 @@
+package fb2
+
+import (
+	"strings"
+)
+
+// NotesMode selects what Flatten does with the notes bodies.
+type NotesMode int
+
+const (
+	// NotesDrop leaves footnotes and comments out of the content.
+	NotesDrop NotesMode = iota
+	// NotesAppend adds the text of the notes bodies after the main body.
+	NotesAppend
+	// NotesInline puts the text of each note in parentheses right after
+	// the link referencing it.
+	NotesInline
+)
+
+// renderer turns paragraphs into plain text. A nil renderer returns the plain
+// text as is; with note set, the text of a note follows every link to it.
+type renderer struct {
+	note func(href string) (string, bool)
+}
+
+func (r *renderer) text(p *Paragraph) string {
+	if r == nil || r.note == nil {
+		return p.PlainText()
+	}
+	var sb strings.Builder
+	r.writeText(&sb, p.Inlines)
+	return sb.String()
+}
+
+func (r *renderer) writeText(sb *strings.Builder, nodes []Inline) {
+	for i := range nodes {
+		n := &nodes[i]
+		switch n.Kind {
+		case InlineText:
+			sb.WriteString(n.Text)
+		case InlineLink:
+			writePlainText(sb, n.Children)
+			if note, ok := r.note(n.Href); ok {
+				sb.WriteString(" (" + note + ")")
+			}
+		default:
+			r.writeText(sb, n.Children)
+		}
+	}
+}
+
+func indexNotes(index map[string]*Section, sections []Section) {
+	for i := range sections {
+		if sections[i].ID != "" {
+			index[sections[i].ID] = &sections[i]
+		}
+		indexNotes(index, sections[i].Sections)
+	}
+}
+
+// Notes returns the sections of the notes bodies indexed by their id.
+func (book *FictionBook) Notes() map[string]*Section {
+	if book.notes == nil {
+		book.notes = make(map[string]*Section)
+		for i := range book.NoteBodies {
+			indexNotes(book.notes, book.NoteBodies[i].Sections)
+		}
+	}
+	return book.notes
+}
+
+// Note returns the note a link points to, or nil. A leading "#", as in link
+// hrefs, is ignored.
+func (book *FictionBook) Note(href string) *Section {
+	if !strings.HasPrefix(href, "#") && strings.Contains(href, ":") {
+		// External link
+		return nil
+	}
+	return book.Notes()[strings.TrimPrefix(href, "#")]
+}
+
+// NoteText returns the text of a note without its title, which usually only
+// repeats the note number.
+func NoteText(note *Section) string {
+	untitled := *note
+	untitled.Title = Title{}
+	return strings.Join(untitled.Lines(), " ")
+}
+
+func (book *FictionBook) contentLines(mode NotesMode) []string {
+	var r *renderer
+	if mode == NotesInline {
+		r = &renderer{note: func(href string) (string, bool) {
+			note := book.Note(href)
+			if note == nil {
+				return "", false
+			}
+			return NoteText(note), true
+		}}
+	}
+
+	lines := book.Body.lines(r)
+	if mode == NotesAppend {
+		for i := range book.NoteBodies {
+			lines = append(lines, book.NoteBodies[i].Lines()...)
+		}
+	}
+	return lines
+}
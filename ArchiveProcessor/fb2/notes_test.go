@@ -0,0 +1,55 @@
+package fb2
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseTestBook(t *testing.T, path string) *FictionBook {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	book, err := ParseFictionBook(data)
+	assert.NoError(t, err)
+	return book
+}
+
+func TestNoteBodies(t *testing.T) {
+	book := parseTestBook(t, "testdata/177693.fb2")
+
+	assert.Equal(t, "", book.Body.Name)
+	assert.Equal(t, 1, len(book.NoteBodies))
+	assert.Equal(t, "notes", book.NoteBodies[0].Name)
+	for _, s := range book.Body.Sections {
+		assert.NotEqual(t, "n_1", s.ID)
+	}
+
+	note := book.Note("#n_1")
+	assert.NotNil(t, note)
+	assert.Equal(t, "n_1", note.ID)
+	assert.True(t, strings.HasPrefix(NoteText(note), "Примечание пер.: Бейсбол"))
+	assert.Nil(t, book.Note("#missing"))
+	assert.Nil(t, book.Note("http://example.com/#n_1"))
+}
+
+func TestFlattenNotes(t *testing.T) {
+	book := parseTestBook(t, "testdata/177693.fb2")
+
+	dropped := strings.Join(book.contentLines(NotesDrop), "\n")
+	assert.Contains(t, dropped, "к мотелю «Бэйвью»[2]. Это")
+	assert.NotContains(t, dropped, "Бейсбол напоминает")
+
+	inlined := book.contentLines(NotesInline)
+	assert.Contains(t, strings.Join(inlined, "\n"), "к мотелю «Бэйвью»[2] («Вид на залив» — (примеч. перев.)). Это")
+	// Links in titles get their notes too, and the notes body is left out.
+	assert.True(t, strings.HasPrefix(inlined[0], "СМЕРТЬ НА КОНЧИКЕ БИТЫ[1] (Примечание пер.: Бейсбол напоминает"))
+	assert.NotContains(t, inlined, "Примечания")
+
+	appended := book.contentLines(NotesAppend)
+	assert.Equal(t, "Примечания", appended[len(book.contentLines(NotesDrop))])
+	assert.Contains(t, strings.Join(appended, "\n"), "Бейсбол напоминает")
+
+	assert.Equal(t, book.Flatten(), book.FlattenWithOptions(FlattenOptions{Notes: NotesDrop}))
+}
@@ -0,0 +1,85 @@
+package fb2
+
+import (
+	"ArchiveProcessor/langid"
+	"ArchiveProcessor/normalize"
+	"strings"
+)
+
+// AuthorName is the name of an author as stored in a Record.
+type AuthorName struct {
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	MiddleName string `json:"middle_name"`
+	NickName   string `json:"nick_name"`
+}
+
+// Name returns the name parts of the author, with surrounding whitespace
+// removed.
+func (a *Author) Name() AuthorName {
+	return AuthorName{
+		FirstName:  strings.TrimSpace(a.FirstName),
+		LastName:   strings.TrimSpace(a.LastName),
+		MiddleName: strings.TrimSpace(a.MiddleName),
+		NickName:   strings.TrimSpace(a.NickName),
+	}
+}
+
+// Record is the flat form of a book shared by the tools: archive-processor
+// writes records as JSON lines, json2csv reads them and fb2/sample prints
+// them.
+type Record struct {
+	ID     string   `json:"id"`
+	Genres []string `json:"genre"`
+	// GenreClass is the coarse class of the genres, see genre.Classifier.
+	GenreClass string       `json:"genre_class,omitempty"`
+	Authors    []AuthorName `json:"author"`
+	BookTitle  string       `json:"book_title"`
+	Body       string       `json:"body"`
+	Annotation string       `json:"annotation"`
+	FileName   string       `json:"file_name"`
+	// Lang is the <lang> tag of the title-info, see langid.NormalizeTag.
+	Lang string `json:"lang"`
+	// DetectedLang and LangConfidence hold the language identified from
+	// the body text, if the caller ran an identifier.
+	DetectedLang   string  `json:"detected_lang,omitempty"`
+	LangConfidence float64 `json:"lang_confidence,omitempty"`
+	// Windows holds the windows of text the body was sampled from, when
+	// there are several, see package window. The body is the windows
+	// joined by window.Separator.
+	Windows []string `json:"windows,omitempty"`
+	// Segments holds the body split into sentences or segments, if the
+	// caller asked for it, see package segment.
+	Segments []string `json:"segments,omitempty"`
+	// InputIDs and AttentionMask hold the BERT input of each segment, or
+	// of the body if it is not segmented, see package wordpiece.
+	InputIDs      [][]int `json:"input_ids,omitempty"`
+	AttentionMask [][]int `json:"attention_mask,omitempty"`
+}
+
+// Record returns the record of the book. The body holds the text of the main
+// body, one paragraph per line, and leaves out the notes bodies. Authors are
+// taken from the title-info only. ID and FileName are left for the caller to
+// set.
+func (book *FictionBook) Record() Record {
+	ti := &book.Description.TitleInfo
+	rec := Record{
+		Genres:     ti.Genres,
+		BookTitle:  strings.TrimSpace(ti.BookTitle),
+		Body:       strings.Join(book.contentLines(NotesDrop), "\n"),
+		Annotation: ti.Annotation.Content,
+		Lang:       langid.NormalizeTag(ti.Lang),
+	}
+	for i := range ti.Authors {
+		rec.Authors = append(rec.Authors, ti.Authors[i].Name())
+	}
+	return rec
+}
+
+// Normalize applies the normalization steps to the title, body and
+// annotation.
+func (rec *Record) Normalize(steps normalize.Steps) {
+	rec.BookTitle = steps.Apply(rec.BookTitle)
+	rec.Body = steps.Apply(rec.Body)
+	rec.Annotation = steps.Apply(rec.Annotation)
+}
@@ -0,0 +1,74 @@
+package fb2
+
+import (
+	"ArchiveProcessor/langid"
+	"ArchiveProcessor/normalize"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecord(t *testing.T) {
+	book := parseTestBook(t, "testdata/177693.fb2")
+	rec := book.Record()
+
+	assert.Equal(t, book.Description.TitleInfo.BookTitle, rec.BookTitle)
+	assert.Equal(t, book.Description.TitleInfo.Genres, rec.Genres)
+	assert.Equal(t, len(book.Description.TitleInfo.Authors), len(rec.Authors))
+	assert.Equal(t, "", rec.ID)
+	assert.Equal(t, "ru", rec.Lang)
+
+	// Notes are not part of the body.
+	assert.NotContains(t, rec.Body, "Примечание пер.: Бейсбол")
+	assert.True(t, strings.Contains(rec.Body, "\n"))
+}
+
+func TestRecordAuthors(t *testing.T) {
+	book := parseTestBook(t, "testbook.xml")
+	rec := book.Record()
+
+	// The document-info author is not a book author.
+	for _, a := range rec.Authors {
+		assert.NotEqual(t, book.Description.DocumentInfo.Authors[0].Name(), a)
+	}
+	assert.Equal(t, len(book.Description.TitleInfo.Authors), len(rec.Authors))
+}
+
+func TestRecordJSON(t *testing.T) {
+	rec := Record{
+		ID:      "a.zip/1.fb2",
+		Genres:  []string{"sf"},
+		Authors: []AuthorName{{FirstName: "Иван", LastName: "Иванов"}},
+	}
+	data, err := json.Marshal(rec)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":"a.zip/1.fb2","genre":["sf"],"author":[{"first_name":"Иван",`+
+		`"last_name":"Иванов","middle_name":"","nick_name":""}],"book_title":"","body":"",`+
+		`"annotation":"","file_name":"","lang":""}`, string(data))
+}
+
+func TestRecordLang(t *testing.T) {
+	// Tagged RU.
+	book := parseTestBook(t, "testdata/184977.fb2")
+	assert.Equal(t, "ru", book.Record().Lang)
+
+	for _, file := range []string{"testdata/177691.fb2", "testdata/177693.fb2", "testdata/184977.fb2"} {
+		result := langid.Default().Identify(parseTestBook(t, file).Record().Body)
+		assert.Equal(t, "ru", result.Lang, file)
+		assert.Greater(t, result.Confidence, 0.99, file)
+	}
+}
+
+func TestRecordNormalize(t *testing.T) {
+	rec := Record{
+		BookTitle:  "Ёлка ",
+		Body:       "погода.\nЭти\u00ad острова - \"наши\"",
+		Annotation: "Пере\u200bнос",
+	}
+	rec.Normalize(normalize.Steps{normalize.Controls, normalize.Whitespace, normalize.Quotes, normalize.Dashes, normalize.Yo})
+	assert.Equal(t, "Елка", rec.BookTitle)
+	assert.Equal(t, "погода.\nЭти острова — «наши»", rec.Body)
+	assert.Equal(t, "Перенос", rec.Annotation)
+}
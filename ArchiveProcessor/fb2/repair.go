@@ -0,0 +1,541 @@
+package fb2
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// RepairKind classifies the fixes applied by RepairXML.
+type RepairKind string
+
+const (
+	// RepairEntity replaced an HTML entity such as &nbsp; by its character.
+	RepairEntity RepairKind = "html-entity"
+	// RepairEscape escaped a stray & or <.
+	RepairEscape RepairKind = "unescaped-char"
+	// RepairInvalidChar dropped a character not allowed in XML.
+	RepairInvalidChar RepairKind = "invalid-char"
+	// RepairProlog dropped an XML declaration following other content,
+	// usually a second declaration.
+	RepairProlog RepairKind = "duplicate-prolog"
+	// RepairTag fixed a malformed start tag: an unquoted, valueless or
+	// repeated attribute, a stray character or a missing >.
+	RepairTag RepairKind = "bad-tag"
+	// RepairNesting closed elements left open when an enclosing element
+	// ended.
+	RepairNesting RepairKind = "bad-nesting"
+	// RepairEndTag dropped an end tag without a matching start tag.
+	RepairEndTag RepairKind = "stray-end-tag"
+	// RepairTruncated dropped incomplete markup at the end of the document
+	// and closed the elements still open.
+	RepairTruncated RepairKind = "truncated"
+	// RepairBinary dropped a binary whose content could not be decoded.
+	RepairBinary RepairKind = "bad-binary"
+)
+
+// Repair is a single fix applied to a malformed document.
+type Repair struct {
+	Kind RepairKind `json:"kind"`
+	// Line is the line of the input the fix applies to.
+	Line int `json:"line"`
+	// Text is the offending input, shortened.
+	Text string `json:"text,omitempty"`
+}
+
+func (r Repair) String() string {
+	return fmt.Sprintf("%d: %s %q", r.Line, r.Kind, r.Text)
+}
+
+// CountRepairs returns the number of repairs of each kind.
+func CountRepairs(repairs []Repair) map[RepairKind]int {
+	counts := make(map[RepairKind]int)
+	for _, r := range repairs {
+		counts[r.Kind]++
+	}
+	return counts
+}
+
+// maxReferenceLen bounds the length of entity references looked for after &.
+const maxReferenceLen = 40
+
+// maxRepairText bounds Repair.Text.
+const maxRepairText = 40
+
+var predefinedEntities = map[string]bool{
+	"amp": true, "lt": true, "gt": true, "quot": true, "apos": true,
+}
+
+type repairer struct {
+	in  []byte
+	pos int
+	out bytes.Buffer
+
+	stack      []string
+	seenRoot   bool
+	seenProlog bool
+	truncated  bool
+
+	repairs []Repair
+	// offsets holds the input offset of each repair until lines are known.
+	offsets []int
+}
+
+// RepairXML fixes common breakage in a UTF-8 document so that it can be
+// parsed: HTML entities, unescaped & and <, characters not allowed in XML,
+// misplaced XML declarations, malformed attributes, badly nested or stray
+// end tags and truncated endings. It returns the repaired document and the
+// fixes applied, which are empty for well-formed documents. Content after
+// the end of the root element is left alone.
+func RepairXML(data []byte) ([]byte, []Repair) {
+	r := &repairer{in: data}
+	r.out.Grow(len(data))
+
+	for r.pos < len(r.in) {
+		if r.seenRoot && len(r.stack) == 0 {
+			r.out.Write(r.in[r.pos:])
+			r.pos = len(r.in)
+			break
+		}
+
+		next := bytes.IndexByte(r.in[r.pos:], '<')
+		if next < 0 {
+			next = len(r.in) - r.pos
+		}
+		if next > 0 {
+			r.writeText(&r.out, r.in[r.pos:r.pos+next], r.pos, 0)
+			r.pos += next
+			continue
+		}
+		r.markup()
+	}
+	r.finish()
+	r.setLines()
+	return r.out.Bytes(), r.repairs
+}
+
+func (r *repairer) repair(kind RepairKind, offset int, text string) {
+	if len(text) > maxRepairText {
+		cut := maxRepairText
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut] + "…"
+	}
+	r.repairs = append(r.repairs, Repair{Kind: kind, Text: text})
+	r.offsets = append(r.offsets, offset)
+}
+
+func (r *repairer) setLines() {
+	line, pos := 1, 0
+	for i, offset := range r.offsets {
+		offset = min(offset, len(r.in))
+		if offset > pos {
+			line += bytes.Count(r.in[pos:offset], []byte{'\n'})
+			pos = offset
+		}
+		r.repairs[i].Line = line
+	}
+	r.offsets = nil
+}
+
+// truncate drops the rest of the input, which holds incomplete markup.
+func (r *repairer) truncate() {
+	r.truncated = true
+	r.pos = len(r.in)
+}
+
+func (r *repairer) finish() {
+	if !r.truncated && len(r.stack) == 0 {
+		return
+	}
+	r.repair(RepairTruncated, len(r.in), strings.Join(r.stack, "/"))
+	for i := len(r.stack) - 1; i >= 0; i-- {
+		r.out.WriteString("</" + r.stack[i] + ">")
+	}
+	r.stack = nil
+}
+
+func (r *repairer) markup() {
+	rest := r.in[r.pos:]
+	switch {
+	case bytes.HasPrefix(rest, []byte("<?")):
+		end := bytes.Index(rest, []byte("?>"))
+		if end < 0 {
+			r.truncate()
+			return
+		}
+		pi := rest[:end+2]
+		if len(pi) > 5 && string(pi[:5]) == "<?xml" && (isSpace(pi[5]) || pi[5] == '?') {
+			if r.seenProlog || r.seenRoot || len(bytes.TrimSpace(r.out.Bytes())) > 0 {
+				r.repair(RepairProlog, r.pos, string(pi))
+				r.pos += len(pi)
+				return
+			}
+			r.seenProlog = true
+		}
+		r.copy(len(pi))
+	case bytes.HasPrefix(rest, []byte("<!--")):
+		r.copyUntil(4, "-->")
+	case bytes.HasPrefix(rest, []byte("<![CDATA[")):
+		r.copyUntil(9, "]]>")
+	case bytes.HasPrefix(rest, []byte("<!")):
+		r.declaration()
+	case bytes.HasPrefix(rest, []byte("</")):
+		r.endTag()
+	case len(rest) > 1 && isNameByte(rest[1], true):
+		r.startTag()
+	default:
+		r.repair(RepairEscape, r.pos, "<")
+		r.out.WriteString("&lt;")
+		r.pos++
+	}
+}
+
+func (r *repairer) copy(n int) {
+	r.out.Write(r.in[r.pos : r.pos+n])
+	r.pos += n
+}
+
+func (r *repairer) copyUntil(skip int, end string) {
+	i := bytes.Index(r.in[r.pos+skip:], []byte(end))
+	if i < 0 {
+		r.truncate()
+		return
+	}
+	r.copy(skip + i + len(end))
+}
+
+// declaration copies a <!DOCTYPE ...> or similar declaration, which may hold
+// an internal subset in brackets.
+func (r *repairer) declaration() {
+	depth := 0
+	var quote byte
+	for i := r.pos + 2; i < len(r.in); i++ {
+		c := r.in[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '>' && depth <= 0:
+			r.copy(i + 1 - r.pos)
+			return
+		}
+	}
+	r.truncate()
+}
+
+func (r *repairer) endTag() {
+	start := r.pos
+	nameEnd := r.scanName(r.pos + 2)
+	name := string(r.in[r.pos+2 : nameEnd])
+	if name == "" {
+		r.repair(RepairEscape, r.pos, "<")
+		r.out.WriteString("&lt;")
+		r.pos++
+		return
+	}
+
+	p := r.skipSpace(nameEnd)
+	switch {
+	case p >= len(r.in):
+		r.truncate()
+		return
+	case r.in[p] == '>':
+		r.pos = p + 1
+	default:
+		// Junk after the name, drop it up to the closing > if there is one.
+		r.repair(RepairTag, start, string(r.in[start:p+1]))
+		end := bytes.IndexAny(r.in[p:], "<>")
+		switch {
+		case end < 0:
+			r.truncate()
+			return
+		case r.in[p+end] == '>':
+			r.pos = p + end + 1
+		default:
+			r.pos = p + end
+		}
+	}
+	r.closeElement(name, start)
+}
+
+func (r *repairer) closeElement(name string, offset int) {
+	i := len(r.stack) - 1
+	for i >= 0 && r.stack[i] != name {
+		i--
+	}
+	if i < 0 {
+		r.repair(RepairEndTag, offset, "</"+name+">")
+		return
+	}
+
+	for j := len(r.stack) - 1; j > i; j-- {
+		r.repair(RepairNesting, offset, "<"+r.stack[j]+">")
+		r.out.WriteString("</" + r.stack[j] + ">")
+	}
+	r.out.WriteString("</" + name + ">")
+	r.stack = r.stack[:i]
+}
+
+func (r *repairer) startTag() {
+	start := r.pos
+	nameEnd := r.scanName(r.pos + 1)
+	name := string(r.in[r.pos+1 : nameEnd])
+
+	var tag bytes.Buffer
+	tag.WriteString("<" + name)
+	seen := make(map[string]bool)
+	fixed := false
+	selfClosing := false
+
+	p := nameEnd
+	for {
+		ws := r.skipSpace(p)
+		tag.Write(r.in[p:ws])
+		p = ws
+		if p >= len(r.in) {
+			r.truncate()
+			return
+		}
+
+		c := r.in[p]
+		if c == '>' {
+			p++
+			break
+		}
+		if c == '/' && p+1 < len(r.in) && r.in[p+1] == '>' {
+			selfClosing = true
+			p += 2
+			break
+		}
+		if c == '<' {
+			// Missing >
+			fixed = true
+			break
+		}
+
+		attrStart, attrEnd := p, r.scanName(p)
+		if attrEnd == p {
+			fixed = true
+			p++
+			continue
+		}
+		attr := string(r.in[p:attrEnd])
+		p = attrEnd
+
+		var value []byte
+		valueStart := p
+		quote := byte('"')
+		if q := r.skipSpace(p); q < len(r.in) && r.in[q] == '=' {
+			q = r.skipSpace(q + 1)
+			if q >= len(r.in) {
+				r.truncate()
+				return
+			}
+			if c := r.in[q]; c == '"' || c == '\'' {
+				valueStart = q + 1
+				end := bytes.IndexByte(r.in[valueStart:], c)
+				if end < 0 {
+					end = len(r.in) - valueStart
+				}
+				value = r.in[valueStart : valueStart+end]
+				p = valueStart + end + 1
+				if lt := bytes.IndexByte(value, '<'); lt >= 0 || p > len(r.in) {
+					// Most likely a missing closing quote, end the value
+					// at the end of the tag.
+					gt := bytes.IndexByte(value, '>')
+					switch {
+					case gt >= 0 && (lt < 0 || gt < lt):
+						fixed = true
+						value = value[:gt]
+						p = valueStart + gt
+					case p > len(r.in):
+						r.truncate()
+						return
+					}
+				}
+				quote = c
+			} else {
+				fixed = true
+				end := q
+				for end < len(r.in) && !isSpace(r.in[end]) && r.in[end] != '>' && r.in[end] != '<' &&
+					!(r.in[end] == '/' && end+1 < len(r.in) && r.in[end+1] == '>') {
+					end++
+				}
+				value = r.in[q:end]
+				valueStart = q
+				p = end
+			}
+		} else {
+			// HTML style attribute without a value.
+			fixed = true
+			value = []byte(attr)
+			valueStart = attrStart
+		}
+
+		if seen[attr] {
+			fixed = true
+			continue
+		}
+		seen[attr] = true
+		tag.WriteString(attr + "=")
+		tag.WriteByte(quote)
+		r.writeText(&tag, value, valueStart, quote)
+		tag.WriteByte(quote)
+	}
+
+	if fixed {
+		r.repair(RepairTag, start, string(r.in[start:p]))
+	}
+	if selfClosing {
+		tag.WriteString("/>")
+	} else {
+		tag.WriteString(">")
+		r.stack = append(r.stack, name)
+	}
+	r.seenRoot = true
+	r.out.Write(tag.Bytes())
+	r.pos = p
+}
+
+// writeText writes character data, or an attribute value delimited by quote,
+// to w, fixing references and invalid characters.
+func (r *repairer) writeText(w *bytes.Buffer, text []byte, offset int, quote byte) {
+	last := 0
+	for i := 0; i < len(text); {
+		c := text[i]
+		if c >= 0x20 && c < utf8.RuneSelf && c != '&' && c != '<' && c != quote || c == '\t' || c == '\n' || c == '\r' {
+			i++
+			continue
+		}
+		if c >= utf8.RuneSelf {
+			ch, size := utf8.DecodeRune(text[i:])
+			if !(ch == utf8.RuneError && size == 1) && isXMLChar(ch) {
+				i += size
+				continue
+			}
+		}
+
+		w.Write(text[last:i])
+		switch {
+		case c == '&':
+			i += r.reference(w, text[i:], offset+i)
+		case c == '<':
+			r.repair(RepairEscape, offset+i, "<")
+			w.WriteString("&lt;")
+			i++
+		case quote != 0 && c == quote:
+			// Only found in unquoted values, already reported.
+			w.WriteString("&quot;")
+			i++
+		default:
+			ch, size := utf8.DecodeRune(text[i:])
+			if ch == utf8.RuneError && size == 1 {
+				r.repair(RepairInvalidChar, offset+i, fmt.Sprintf("\\x%02x", c))
+			} else {
+				r.repair(RepairInvalidChar, offset+i, fmt.Sprintf("%U", ch))
+			}
+			i += size
+		}
+		last = i
+	}
+	w.Write(text[last:])
+}
+
+// reference writes the reference starting with & at the start of text to w,
+// and returns the number of bytes it took.
+func (r *repairer) reference(w *bytes.Buffer, text []byte, offset int) int {
+	limit := len(text)
+	if limit > maxReferenceLen {
+		limit = maxReferenceLen
+	}
+	end := bytes.IndexByte(text[:limit], ';')
+	if end > 1 {
+		ref := string(text[:end+1])
+		name := ref[1:end]
+		if predefinedEntities[name] {
+			w.WriteString(ref)
+			return end + 1
+		}
+		if ch, ok := charReference(name); ok {
+			if isXMLChar(ch) {
+				w.WriteString(ref)
+			} else {
+				r.repair(RepairInvalidChar, offset, ref)
+			}
+			return end + 1
+		}
+		if s := html.UnescapeString(ref); s != ref {
+			r.repair(RepairEntity, offset, ref)
+			xml.EscapeText(w, []byte(s))
+			return end + 1
+		}
+	}
+
+	r.repair(RepairEscape, offset, "&")
+	w.WriteString("&amp;")
+	return 1
+}
+
+// charReference parses the name of a character reference as accepted by
+// encoding/xml, such as #160 or #xA0.
+func charReference(name string) (rune, bool) {
+	var n uint64
+	var err error
+	switch {
+	case strings.HasPrefix(name, "#x"):
+		n, err = strconv.ParseUint(name[2:], 16, 32)
+	case strings.HasPrefix(name, "#"):
+		n, err = strconv.ParseUint(name[1:], 10, 32)
+	default:
+		return 0, false
+	}
+	if err != nil || n > utf8.MaxRune {
+		return 0, false
+	}
+	return rune(n), true
+}
+
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= utf8.MaxRune
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isNameByte(c byte, first bool) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || c >= utf8.RuneSelf ||
+		!first && (c >= '0' && c <= '9' || c == '-' || c == '.')
+}
+
+func (r *repairer) scanName(p int) int {
+	if p >= len(r.in) || !isNameByte(r.in[p], true) {
+		return p
+	}
+	for p++; p < len(r.in) && isNameByte(r.in[p], false); p++ {
+	}
+	return p
+}
+
+func (r *repairer) skipSpace(p int) int {
+	for p < len(r.in) && isSpace(r.in[p]) {
+		p++
+	}
+	return p
+}
@@ -0,0 +1,198 @@
+package fb2
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func repairKinds(repairs []Repair) []RepairKind {
+	var kinds []RepairKind
+	for _, r := range repairs {
+		kinds = append(kinds, r.Kind)
+	}
+	return kinds
+}
+
+func TestRepairXML(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		out   string
+		kinds []RepairKind
+	}{
+		{
+			name: "well-formed",
+			in:   `<?xml version="1.0"?><a x='1'><!-- c --><b>&amp;&#160;&#xA0;<![CDATA[<&>]]></b><c/></a>`,
+			out:  `<?xml version="1.0"?><a x='1'><!-- c --><b>&amp;&#160;&#xA0;<![CDATA[<&>]]></b><c/></a>`,
+		},
+		{
+			name:  "html entities",
+			in:    `<a>a&nbsp;b&mdash;c&laquo;&#X41;</a>`,
+			out:   "<a>a b—c«" + `A</a>`,
+			kinds: []RepairKind{RepairEntity, RepairEntity, RepairEntity, RepairEntity},
+		},
+		{
+			name:  "stray ampersand and less-than",
+			in:    `<a>AT&T & co; 1 < 2 &unknown;</a>`,
+			out:   `<a>AT&amp;T &amp; co; 1 &lt; 2 &amp;unknown;</a>`,
+			kinds: []RepairKind{RepairEscape, RepairEscape, RepairEscape, RepairEscape},
+		},
+		{
+			name:  "invalid characters",
+			in:    "<a>a\x01b\xffc&#1;</a>",
+			out:   "<a>abc</a>",
+			kinds: []RepairKind{RepairInvalidChar, RepairInvalidChar, RepairInvalidChar},
+		},
+		{
+			name:  "duplicate prolog",
+			in:    `<?xml version="1.0" encoding="utf-8"?>` + "\n" + `<?xml version="1.0"?><a/>`,
+			out:   `<?xml version="1.0" encoding="utf-8"?>` + "\n" + `<a/>`,
+			kinds: []RepairKind{RepairProlog},
+		},
+		{
+			name:  "attributes",
+			in:    `<td colspan=2 nowrap id="a&b" id="c">x</td>`,
+			out:   `<td colspan="2" nowrap="nowrap" id="a&amp;b" >x</td>`,
+			kinds: []RepairKind{RepairEscape, RepairTag},
+		},
+		{
+			name:  "missing closing quote",
+			in:    `<a><p id="x>text</p></a>`,
+			out:   `<a><p id="x">text</p></a>`,
+			kinds: []RepairKind{RepairTag},
+		},
+		{
+			name:  "bad nesting",
+			in:    `<a><p><emphasis>x</p></emphasis></a>`,
+			out:   `<a><p><emphasis>x</emphasis></p></a>`,
+			kinds: []RepairKind{RepairNesting, RepairEndTag},
+		},
+		{
+			name:  "truncated",
+			in:    `<a><b><p>some te`,
+			out:   `<a><b><p>some te</p></b></a>`,
+			kinds: []RepairKind{RepairTruncated},
+		},
+		{
+			name:  "truncated tag",
+			in:    `<a><b>x</b><p id="`,
+			out:   `<a><b>x</b></a>`,
+			kinds: []RepairKind{RepairTruncated},
+		},
+		{
+			name: "trailing content",
+			in:   `<a/> & <b>`,
+			out:  `<a/> & <b>`,
+		},
+	}
+
+	for _, tt := range tests {
+		out, repairs := RepairXML([]byte(tt.in))
+		assert.Equal(t, tt.out, string(out), tt.name)
+		assert.Equal(t, tt.kinds, repairKinds(repairs), tt.name)
+	}
+}
+
+func TestRepairLines(t *testing.T) {
+	_, repairs := RepairXML([]byte("<a>\n<b>x&nbsp;y</b>\n\n<c>\n"))
+	assert.Equal(t, []Repair{
+		{Kind: RepairEntity, Line: 2, Text: "&nbsp;"},
+		{Kind: RepairTruncated, Line: 5, Text: "a/c"},
+	}, repairs)
+}
+
+func TestRepairValuelessAttribute(t *testing.T) {
+	// The invalid characters of a valueless attribute are found at the
+	// attribute, not past it, nor past the end of the input.
+	out, repairs := RepairXML([]byte("<AA=7\xe6c\x8f\xa5\xfaw\x84"))
+	assert.Empty(t, out)
+	assert.Equal(t, RepairTruncated, repairs[len(repairs)-1].Kind)
+	for _, r := range repairs {
+		assert.Equal(t, 1, r.Line, r)
+	}
+
+	_, repairs = RepairXML([]byte("<a \xff\xff\n\n/>"))
+	assert.Equal(t, []Repair{
+		{Kind: RepairInvalidChar, Line: 1, Text: `\xff`},
+		{Kind: RepairInvalidChar, Line: 1, Text: `\xff`},
+		{Kind: RepairTag, Line: 1, Text: "<a \xff\xff\n\n/>"},
+	}, repairs)
+}
+
+func FuzzRepairXML(f *testing.F) {
+	f.Add([]byte("<AA=7\xe6c\x8f\xa5\xfaw\x84"))
+	f.Add([]byte("<a x=1 y z='2>&nbsp;<b>\n</a>"))
+	f.Add([]byte("<?xml version=\"1.0\"?><a><![CDATA[x]]><!-- c --></b>"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, repairs := RepairXML(data)
+		lines := bytes.Count(data, []byte{'\n'}) + 1
+		for _, r := range repairs {
+			if r.Line < 1 || r.Line > lines {
+				t.Fatalf("repair %v outside the %d lines of the input", r, lines)
+			}
+		}
+	})
+}
+
+func TestParseFictionBookLenient(t *testing.T) {
+	data, err := os.ReadFile("testdata/177691.fb2")
+	assert.NoError(t, err)
+	book, err := ParseFictionBook(data)
+	assert.NoError(t, err)
+
+	_, repairs, err := ParseFictionBookLenient(data)
+	assert.NoError(t, err)
+	assert.Empty(t, repairs)
+
+	// Break the book: an HTML entity, a duplicated prolog and the last
+	// third cut off.
+	broken := bytes.Replace(data, []byte("<body>"), []byte("<body>&nbsp;"), 1)
+	broken = append(broken[:bytes.Index(broken, []byte("?>"))+2], broken...)
+	broken = broken[:len(broken)*2/3]
+
+	_, err = ParseFictionBook(broken)
+	assert.Error(t, err)
+
+	repaired, repairs, err := ParseFictionBookLenient(broken)
+	assert.NoError(t, err)
+	assert.Equal(t, []RepairKind{RepairProlog, RepairEntity, RepairTruncated}, repairKinds(repairs))
+	assert.Equal(t, book.Description.TitleInfo.BookTitle, repaired.Description.TitleInfo.BookTitle)
+	assert.Equal(t, book.Body.Sections[0].Title, repaired.Body.Sections[0].Title)
+	assert.Equal(t, repairs, repaired.Repairs)
+	assert.Equal(t, map[RepairKind]int{RepairProlog: 1, RepairEntity: 1, RepairTruncated: 1}, CountRepairs(repairs))
+}
+
+func TestRepairBinary(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0">
+<body><section><p>text</p></section></body>
+<binary id="good.png" content-type="image/png">` + base64.StdEncoding.EncodeToString([]byte("png data")) + `</binary>
+<binary id="cut.png" content-type="image/png">` + strings.Repeat("QUJD", 10)[:25])
+
+	_, err := ParseFictionBookReader(bytes.NewReader(data), ReaderOptions{KeepBinaries: true})
+	assert.Error(t, err)
+
+	book, err := ParseFictionBookReader(bytes.NewReader(data), ReaderOptions{KeepBinaries: true, Repair: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(book.Binaries))
+	assert.Equal(t, "good.png", book.Binaries[0].ID)
+	assert.Equal(t, []RepairKind{RepairTruncated, RepairBinary}, repairKinds(book.Repairs))
+	assert.Equal(t, "cut.png", book.Repairs[1].Text)
+
+	// A binary that is not base64 is dropped without repairing the book.
+	data = []byte(`<?xml version="1.0" encoding="utf-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0">
+<body><section><p>text</p></section></body>
+<binary id="bad.png" content-type="image/png">not*base64</binary>
+</FictionBook>`)
+	book, err = ParseFictionBook(data)
+	assert.NoError(t, err)
+	assert.Empty(t, book.Binaries)
+	assert.Equal(t, []Repair{{Kind: RepairBinary, Line: 4, Text: "bad.png"}}, book.Repairs)
+	assert.Equal(t, "text", book.Body.Sections[0].Content[0])
+}
@@ -0,0 +1,175 @@
+package fb2
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// InlineKind identifies the kind of an Inline node.
+type InlineKind int
+
+const (
+	InlineText InlineKind = iota
+	InlineStrong
+	InlineEmphasis
+	InlineStyle
+	InlineLink
+	InlineStrikethrough
+	InlineSub
+	InlineSup
+	InlineCode
+	InlineImage
+)
+
+var inlineKindByElement = map[string]InlineKind{
+	"strong":        InlineStrong,
+	"emphasis":      InlineEmphasis,
+	"style":         InlineStyle,
+	"a":             InlineLink,
+	"strikethrough": InlineStrikethrough,
+	"sub":           InlineSub,
+	"sup":           InlineSup,
+	"code":          InlineCode,
+	"image":         InlineImage,
+}
+
+// Inline is a node of the rich text tree of a paragraph. Text nodes carry
+// Text, all other kinds carry Children.
+type Inline struct {
+	Kind     InlineKind
+	Text     string
+	Children []Inline
+
+	// Name is the style name of an InlineStyle node.
+	Name string
+	// Href is the target of an InlineLink or InlineImage node.
+	Href string
+	// LinkType is the type attribute of an InlineLink, "note" for footnotes.
+	LinkType string
+	// Alt is the alternative text of an InlineImage.
+	Alt string
+}
+
+// ElementName returns the FB2 element name of the node, or "" for text.
+func (n *Inline) ElementName() string {
+	for name, kind := range inlineKindByElement {
+		if kind == n.Kind {
+			return name
+		}
+	}
+	return ""
+}
+
+func decodeInlines(d *xml.Decoder) ([]Inline, error) {
+	var nodes []Inline
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			if n := len(nodes); n > 0 && nodes[n-1].Kind == InlineText {
+				nodes[n-1].Text += string(t)
+			} else {
+				nodes = append(nodes, Inline{Kind: InlineText, Text: string(t)})
+			}
+		case xml.StartElement:
+			children, err := decodeInlines(d)
+			if err != nil {
+				return nil, err
+			}
+
+			kind, known := inlineKindByElement[t.Name.Local]
+			if !known {
+				// Keep the text of elements the schema does not allow here.
+				nodes = append(nodes, children...)
+				continue
+			}
+
+			node := Inline{Kind: kind, Children: children}
+			switch kind {
+			case InlineStyle:
+				node.Name = attr(t, "name")
+			case InlineLink:
+				node.Href = attr(t, "href")
+				node.LinkType = attr(t, "type")
+			case InlineImage:
+				node.Href = attr(t, "href")
+				node.Alt = attr(t, "alt")
+			}
+			nodes = append(nodes, node)
+		case xml.EndElement:
+			return nodes, nil
+		}
+	}
+}
+
+func writePlainText(sb *strings.Builder, nodes []Inline) {
+	for i := range nodes {
+		if nodes[i].Kind == InlineText {
+			sb.WriteString(nodes[i].Text)
+		} else {
+			writePlainText(sb, nodes[i].Children)
+		}
+	}
+}
+
+var markupDelimiters = map[InlineKind]string{
+	InlineStrong:        "**",
+	InlineEmphasis:      "*",
+	InlineStrikethrough: "~~",
+	InlineSub:           "~",
+	InlineSup:           "^",
+	InlineCode:          "`",
+}
+
+func writeMarkup(sb *strings.Builder, nodes []Inline) {
+	for i := range nodes {
+		n := &nodes[i]
+		switch n.Kind {
+		case InlineText:
+			sb.WriteString(n.Text)
+		case InlineLink:
+			sb.WriteString("[")
+			writeMarkup(sb, n.Children)
+			sb.WriteString("](" + n.Href + ")")
+		case InlineImage:
+			sb.WriteString("![" + n.Alt + "](" + n.Href + ")")
+		case InlineStyle:
+			writeMarkup(sb, n.Children)
+		default:
+			delim := markupDelimiters[n.Kind]
+			sb.WriteString(delim)
+			writeMarkup(sb, n.Children)
+			sb.WriteString(delim)
+		}
+	}
+}
+
+// PlainText returns the text of the nodes with all markup removed.
+func PlainText(nodes []Inline) string {
+	var sb strings.Builder
+	writePlainText(&sb, nodes)
+	return sb.String()
+}
+
+// Markup renders the nodes as Markdown-like text: *emphasis*, **strong**,
+// ~~strikethrough~~, ~sub~, ^sup^, `code`, [link](href) and ![alt](href).
+// Named styles are rendered as their content.
+func Markup(nodes []Inline) string {
+	var sb strings.Builder
+	writeMarkup(&sb, nodes)
+	return sb.String()
+}
+
+// Walk calls fn for every node of the tree in document order. Children are
+// not visited if fn returns false.
+func Walk(nodes []Inline, fn func(*Inline) bool) {
+	for i := range nodes {
+		if fn(&nodes[i]) {
+			Walk(nodes[i].Children, fn)
+		}
+	}
+}
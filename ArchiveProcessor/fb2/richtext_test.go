@@ -0,0 +1,48 @@
+package fb2
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const richParagraph = `<p xmlns:l="http://www.w3.org/1999/xlink" id="p1">` +
+	`— Нет, — <emphasis>подумал он</emphasis>, — <strong>никогда<sup>1</sup></strong>` +
+	`<a l:href="#n_1" type="note">[1]</a>. <style name="foreign">Hello</style>` +
+	`<strikethrough>x</strikethrough><code>y</code><sub>2</sub><image l:href="#i.png" alt="pic"/></p>`
+
+func TestParagraphInlines(t *testing.T) {
+	var p Paragraph
+	assert.NoError(t, xml.Unmarshal([]byte(richParagraph), &p))
+
+	assert.Equal(t, "p1", p.ID)
+	assert.Equal(t, "— Нет, — подумал он, — никогда1[1]. Helloxy2", p.PlainText())
+	assert.Equal(t, "— Нет, — *подумал он*, — **никогда^1^**[[1]](#n_1). Hello~~x~~`y`~2~![pic](#i.png)",
+		p.Markup())
+
+	assert.Equal(t, InlineEmphasis, p.Inlines[1].Kind)
+	assert.Equal(t, "emphasis", p.Inlines[1].ElementName())
+
+	var links []Inline
+	Walk(p.Inlines, func(n *Inline) bool {
+		if n.Kind == InlineLink {
+			links = append(links, *n)
+		}
+		return true
+	})
+	assert.Equal(t, 1, len(links))
+	assert.Equal(t, "#n_1", links[0].Href)
+	assert.Equal(t, "note", links[0].LinkType)
+}
+
+func TestTitleKeepsInlineText(t *testing.T) {
+	var title Title
+	data := `<title><p>Глава <emphasis>первая</emphasis></p><empty-line/><p>Вторая строка</p></title>`
+	assert.NoError(t, xml.Unmarshal([]byte(data), &title))
+
+	assert.Equal(t, []string{"Глава первая", "Вторая строка"}, title.Content)
+	assert.Equal(t, title.Content, title.Lines())
+	assert.Equal(t, "Глава *первая*", title.Blocks[0].(*Paragraph).Markup())
+	assert.IsType(t, &EmptyLine{}, title.Blocks[1])
+}
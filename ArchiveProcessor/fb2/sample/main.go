@@ -2,6 +2,7 @@ package main
 
 import (
 	"ArchiveProcessor/fb2"
+	"ArchiveProcessor/normalize"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -33,8 +34,14 @@ func main() {
 			panic(err)
 		}
 
-		j := book.Flatten()
-		js, _ := json.Marshal(j)
+		rec := book.Record()
+		rec.Normalize(normalize.Default)
+		rec.FileName = filepath.Base(file)
+		rec.ID = rec.FileName
+		if body := []rune(rec.Body); len(body) > N_CHARS {
+			rec.Body = string(body[:N_CHARS])
+		}
+		js, _ := json.Marshal(rec)
 
 		fmt.Println(string(js))
 	}
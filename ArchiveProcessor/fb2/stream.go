@@ -0,0 +1,287 @@
+package fb2
+
+import (
+	"ArchiveProcessor/normalize"
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// ReaderOptions controls ParseFictionBookReader.
+type ReaderOptions struct {
+	// MaxTextRunes stops parsing once at least this many runes of body text
+	// have been collected. Zero means no limit.
+	MaxTextRunes int
+	// Normalize is the normalization the body text will get, so that
+	// MaxTextRunes counts the runes of the text as it will be used: lines
+	// after normalization, and the newlines between them.
+	Normalize normalize.Steps
+
+	// KeepBinaries decodes <binary> elements into FictionBook.Binaries
+	// instead of discarding them. Binaries follow the bodies, so they are
+	// not read if MaxTextRunes stops parsing early. Binaries that cannot be
+	// decoded are dropped and recorded in FictionBook.Repairs, as broken
+	// covers should not cost the text.
+	KeepBinaries bool
+
+	// Repair runs RepairXML on the document before parsing it and records
+	// the fixes in FictionBook.Repairs. The whole document is read into
+	// memory first.
+	Repair bool
+}
+
+// errTextLimit is returned by the body decoders once the text budget is
+// exhausted.
+var errTextLimit = errors.New("text limit reached")
+
+// textBudget counts the runes of body text still to be collected. A nil
+// budget is unlimited.
+type textBudget struct {
+	remaining int
+	normalize normalize.Steps
+	lines     int
+}
+
+// spend counts lines, normalized, and a newline before each but the first.
+// Lines left empty are not counted, as normalization may drop them.
+func (b *textBudget) spend(lines []string) error {
+	if b == nil {
+		return nil
+	}
+	for _, line := range lines {
+		n := utf8.RuneCountInString(b.normalize.Apply(line))
+		if n == 0 {
+			continue
+		}
+		if b.lines > 0 {
+			n++
+		}
+		b.lines++
+		b.remaining -= n
+	}
+	if b.remaining <= 0 {
+		return errTextLimit
+	}
+	return nil
+}
+
+// ParseFictionBookReader parses a book from r without reading it into memory
+// first. The input is decoded as described in NewDecodingReader. Unless
+// opts.KeepBinaries is set, the content of <binary> elements is discarded
+// before it reaches the XML decoder. With opts.MaxTextRunes set the rest of
+// the book is not read once enough text has been collected; the result is
+// then marked as Truncated.
+func ParseFictionBookReader(r io.Reader, opts ReaderOptions) (*FictionBook, error) {
+	var budget *textBudget
+	if opts.MaxTextRunes > 0 {
+		budget = &textBudget{remaining: opts.MaxTextRunes, normalize: opts.Normalize}
+	}
+
+	decoded, encoding, err := NewDecodingReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.KeepBinaries {
+		decoded = newBinarySkipper(decoded)
+	}
+
+	var repairs []Repair
+	if opts.Repair {
+		data, err := io.ReadAll(decoded)
+		if err != nil {
+			return nil, err
+		}
+		data, repairs = RepairXML(data)
+		decoded = bytes.NewReader(data)
+	}
+
+	d := xml.NewDecoder(decoded)
+	d.CharsetReader = utf8CharsetReader
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no FictionBook element found")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "FictionBook" {
+			return nil, fmt.Errorf("expected element FictionBook, found %s", start.Name.Local)
+		}
+
+		book := &FictionBook{Encoding: encoding, Repairs: repairs}
+		err = book.decode(d, start, opts, budget)
+		if errors.Is(err, errTextLimit) {
+			book.Truncated = true
+			return book, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return book, nil
+	}
+}
+
+func (book *FictionBook) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return book.decode(d, start, ReaderOptions{KeepBinaries: true}, nil)
+}
+
+func (book *FictionBook) decode(d *xml.Decoder, start xml.StartElement, opts ReaderOptions, budget *textBudget) error {
+	book.XMLName = start.Name
+	bodies := 0
+	return decodeChildren(d, func(t xml.StartElement) (bool, error) {
+		switch t.Name.Local {
+		case "description":
+			return true, d.DecodeElement(&book.Description, &t)
+		case "body":
+			// The first body is the main text, the following ones hold
+			// notes and comments.
+			bodies++
+			if bodies == 1 {
+				return true, book.Body.decode(d, t, budget)
+			}
+			var b Body
+			err := b.decode(d, t, budget)
+			book.NoteBodies = append(book.NoteBodies, b)
+			return true, err
+		case "binary":
+			if !opts.KeepBinaries {
+				return false, nil
+			}
+			var b Binary
+			err := d.DecodeElement(&b, &t)
+			var corrupt base64.CorruptInputError
+			if errors.As(err, &corrupt) {
+				line, _ := d.InputPos()
+				book.Repairs = append(book.Repairs, Repair{Kind: RepairBinary, Line: line, Text: b.ID})
+				return true, nil
+			}
+			if err != nil {
+				return true, err
+			}
+			book.Binaries = append(book.Binaries, b)
+			return true, nil
+		}
+		return false, nil
+	})
+}
+
+// binarySkipper passes an FB2 document through unchanged except for the
+// content of <binary> elements, which is dropped. It works on raw bytes and
+// so supports any ASCII-compatible encoding.
+type binarySkipper struct {
+	r       *bufio.Reader
+	state   int
+	matched int
+	quote   byte
+	prev    byte
+	pending []byte
+}
+
+const (
+	skipperText = iota
+	skipperStartTag
+	skipperContent
+)
+
+var (
+	binaryOpen  = []byte("<binary")
+	binaryClose = []byte("</binary")
+)
+
+func newBinarySkipper(r io.Reader) *binarySkipper {
+	return &binarySkipper{r: bufio.NewReader(r)}
+}
+
+func (s *binarySkipper) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		// Do not block for more input once something can be returned.
+		if n > 0 && len(s.pending) == 0 && s.r.Buffered() == 0 {
+			break
+		}
+		if len(s.pending) > 0 {
+			c := copy(p[n:], s.pending)
+			s.pending = s.pending[c:]
+			n += c
+			continue
+		}
+
+		c, err := s.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+
+		switch s.state {
+		case skipperText:
+			p[n] = c
+			n++
+			if s.matched == len(binaryOpen) {
+				s.matched = 0
+				if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '>' || c == '/' {
+					s.state = skipperStartTag
+					s.prev = 0
+					s.endStartTag(c)
+				}
+			} else if c == binaryOpen[s.matched] {
+				s.matched++
+			} else if c == binaryOpen[0] {
+				s.matched = 1
+			} else {
+				s.matched = 0
+			}
+		case skipperStartTag:
+			p[n] = c
+			n++
+			s.endStartTag(c)
+		case skipperContent:
+			if c == binaryClose[s.matched] {
+				s.matched++
+				if s.matched == len(binaryClose) {
+					s.pending = binaryClose
+					s.matched = 0
+					s.state = skipperText
+				}
+			} else if c == binaryClose[0] {
+				s.matched = 1
+			} else {
+				s.matched = 0
+			}
+		}
+	}
+	return n, nil
+}
+
+// endStartTag tracks the bytes of a <binary> start tag and switches to
+// skipping its content once the tag is closed.
+func (s *binarySkipper) endStartTag(c byte) {
+	switch {
+	case s.quote != 0:
+		if c == s.quote {
+			s.quote = 0
+		}
+	case c == '"' || c == '\'':
+		s.quote = c
+	case c == '>':
+		if s.prev == '/' {
+			s.state = skipperText
+		} else {
+			s.state = skipperContent
+		}
+	}
+	s.prev = c
+}
@@ -0,0 +1,98 @@
+package fb2
+
+import (
+	"ArchiveProcessor/normalize"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinarySkipper(t *testing.T) {
+	in := `<a><binary id="c.jpg" content-type="image/jpeg">AAAA<BBB</binar</binary>` +
+		`<binary id='x>y'>CCC</binary><binary/><binaryish>keep</binaryish></a>`
+	expected := `<a><binary id="c.jpg" content-type="image/jpeg"></binary>` +
+		`<binary id='x>y'></binary><binary/><binaryish>keep</binaryish></a>`
+
+	out, err := io.ReadAll(newBinarySkipper(iotest.OneByteReader(strings.NewReader(in))))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(out))
+
+	out, err = io.ReadAll(newBinarySkipper(strings.NewReader(in)))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(out))
+}
+
+func TestParseFictionBookReader(t *testing.T) {
+	f, err := os.Open("testdata/177692.fb2")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	book, err := ParseFictionBookReader(f, ReaderOptions{})
+	assert.NoError(t, err)
+	assert.False(t, book.Truncated)
+	assert.Equal(t, "Конец короля компьютеров", book.Description.TitleInfo.BookTitle)
+	assert.NotEmpty(t, book.Body.Sections)
+}
+
+func TestParseFictionBookReaderStopsEarly(t *testing.T) {
+	data, err := os.ReadFile("testdata/177694.fb2")
+	assert.NoError(t, err)
+
+	full, err := ParseFictionBook(data)
+	assert.NoError(t, err)
+
+	r := &countingReader{r: strings.NewReader(string(data))}
+	book, err := ParseFictionBookReader(r, ReaderOptions{MaxTextRunes: 1000})
+	assert.NoError(t, err)
+	assert.True(t, book.Truncated)
+	assert.Equal(t, full.Description.TitleInfo.BookTitle, book.Description.TitleInfo.BookTitle)
+	assert.Less(t, len(book.Body.Lines()), len(full.Body.Lines()))
+	assert.Less(t, r.n, len(data)/2)
+
+	text := strings.Join(book.Body.Lines(), "")
+	assert.True(t, strings.HasPrefix(strings.Join(full.Body.Lines(), ""), text))
+}
+
+func TestParseFictionBookReaderBudgetNormalized(t *testing.T) {
+	// Every line is 10 runes once its padding is collapsed, and 42 before.
+	var body strings.Builder
+	body.WriteString(`<FictionBook><body><title><p>Заголовок.</p></title><section>`)
+	for i := 0; i < 100; i++ {
+		body.WriteString(`<p>    Строка` + strings.Repeat(" ", 26) + `   ab.</p>`)
+	}
+	body.WriteString(`</section></body></FictionBook>`)
+
+	book, err := ParseFictionBookReader(strings.NewReader(body.String()),
+		ReaderOptions{MaxTextRunes: 100, Normalize: normalize.Default})
+	assert.NoError(t, err)
+	assert.True(t, book.Truncated)
+
+	// The title and nine lines, with the newlines between them, are the first
+	// to reach 100 runes of normalized text. Raw runes would have stopped
+	// after three lines.
+	lines := book.Body.Lines()
+	assert.Len(t, lines, 10)
+	text := normalize.Default.Apply(strings.Join(lines, "\n"))
+	assert.Equal(t, 109, utf8.RuneCountInString(text))
+}
+
+func TestParseFictionBookReaderRejectsOtherRoot(t *testing.T) {
+	_, err := ParseFictionBookReader(strings.NewReader(`<html></html>`), ReaderOptions{})
+	assert.Error(t, err)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
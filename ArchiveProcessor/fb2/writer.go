@@ -0,0 +1,437 @@
+package fb2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Namespace is the FB2 namespace.
+const Namespace = "http://www.gribuser.ru/xml/fictionbook/2.0"
+
+// binaryLineLength is the length of the base64 lines of written binaries.
+const binaryLineLength = 76
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;",
+		"\r", "&#xD;", "\n", "&#xA;", "\t", "&#x9;")
+)
+
+// Marshal returns the book as an FB2 document encoded in UTF-8.
+func Marshal(book *FictionBook) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := book.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo writes the book to w as an FB2 document encoded in UTF-8. Block
+// elements go on lines of their own, the text of paragraphs is written as
+// is.
+func (book *FictionBook) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	fw := &writer{w: bw}
+
+	fw.raw(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fw.raw(`<FictionBook xmlns="` + Namespace + `" xmlns:l="` + XLinkNamespace + `">` + "\n")
+	fw.description(&book.Description)
+	fw.body(&book.Body)
+	for i := range book.NoteBodies {
+		fw.body(&book.NoteBodies[i])
+	}
+	for i := range book.Binaries {
+		fw.binary(&book.Binaries[i])
+	}
+	fw.end("FictionBook")
+
+	if fw.err == nil {
+		fw.err = bw.Flush()
+	}
+	return fw.n, fw.err
+}
+
+// writer writes FB2 elements and keeps the first error.
+type writer struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *writer) raw(s string) {
+	if w.err != nil {
+		return
+	}
+	n, err := io.WriteString(w.w, s)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *writer) text(s string) {
+	w.raw(textEscaper.Replace(s))
+}
+
+// open writes a start tag. attrs holds name and value pairs, attributes with
+// an empty value are left out.
+func (w *writer) open(name string, attrs ...string) {
+	w.raw("<" + name)
+	w.attrs(attrs)
+	w.raw(">")
+}
+
+func (w *writer) attrs(attrs []string) {
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] != "" {
+			w.raw(" " + attrs[i] + `="` + attrEscaper.Replace(attrs[i+1]) + `"`)
+		}
+	}
+}
+
+func (w *writer) start(name string, attrs ...string) {
+	w.open(name, attrs...)
+	w.raw("\n")
+}
+
+func (w *writer) end(name string) {
+	w.raw("</" + name + ">\n")
+}
+
+func (w *writer) empty(name string, attrs ...string) {
+	w.raw("<" + name)
+	w.attrs(attrs)
+	w.raw("/>\n")
+}
+
+// element writes an element with text content.
+func (w *writer) element(name, text string, attrs ...string) {
+	w.open(name, attrs...)
+	w.text(text)
+	w.raw("</" + name + ">\n")
+}
+
+// optional writes an element with text content unless the text is empty.
+func (w *writer) optional(name, text string) {
+	if text != "" {
+		w.element(name, text)
+	}
+}
+
+func (w *writer) description(d *Description) {
+	w.start("description")
+	w.titleInfo("title-info", &d.TitleInfo)
+	if d.SrcTitleInfo != nil {
+		w.titleInfo("src-title-info", d.SrcTitleInfo)
+	}
+	w.documentInfo(&d.DocumentInfo)
+	w.publishInfo(&d.PublishInfo)
+	for _, ci := range d.CustomInfo {
+		// info-type is required, keep it even when empty.
+		w.raw(`<custom-info info-type="` + attrEscaper.Replace(ci.InfoType) + `">`)
+		w.text(ci.Text)
+		w.end("custom-info")
+	}
+	w.end("description")
+}
+
+func (w *writer) titleInfo(name string, ti *TitleInfo) {
+	w.start(name)
+	for _, g := range ti.Genres {
+		match := ""
+		if m, ok := ti.GenreMatches[g]; ok {
+			match = strconv.Itoa(m)
+		}
+		w.element("genre", g, "match", match)
+	}
+	for i := range ti.Authors {
+		w.author("author", &ti.Authors[i])
+	}
+	w.element("book-title", ti.BookTitle)
+	if len(ti.Annotation.Blocks) > 0 {
+		w.annotation("annotation", &ti.Annotation)
+	}
+	w.optional("keywords", ti.Keywords)
+	if ti.Date != (Date{}) {
+		w.date(ti.Date)
+	}
+	if len(ti.CoverPage.Images) > 0 {
+		w.start("coverpage")
+		for i := range ti.CoverPage.Images {
+			w.image(&ti.CoverPage.Images[i])
+		}
+		w.end("coverpage")
+	}
+	w.element("lang", ti.Lang)
+	w.optional("src-lang", ti.SrcLang)
+	for i := range ti.Translators {
+		w.author("translator", &ti.Translators[i])
+	}
+	w.sequences(ti.Sequences)
+	w.end(name)
+}
+
+func (w *writer) author(name string, a *Author) {
+	w.start(name)
+	if a.FirstName != "" || a.LastName != "" || a.NickName == "" {
+		w.element("first-name", a.FirstName)
+		w.optional("middle-name", a.MiddleName)
+		w.element("last-name", a.LastName)
+		w.optional("nickname", a.NickName)
+	} else {
+		w.element("nickname", a.NickName)
+	}
+	for _, hp := range a.HomePages {
+		w.element("home-page", hp)
+	}
+	for _, e := range a.Emails {
+		w.element("email", e)
+	}
+	w.optional("id", a.ID)
+	w.end(name)
+}
+
+func (w *writer) date(d Date) {
+	w.element("date", d.Text, "value", d.Value)
+}
+
+func (w *writer) sequences(seqs []Sequence) {
+	for _, s := range seqs {
+		if len(s.Sequences) == 0 {
+			w.empty("sequence", "name", s.Name, "number", s.Number)
+			continue
+		}
+		w.start("sequence", "name", s.Name, "number", s.Number)
+		w.sequences(s.Sequences)
+		w.end("sequence")
+	}
+}
+
+func (w *writer) documentInfo(di *DocumentInfo) {
+	w.start("document-info")
+	for i := range di.Authors {
+		w.author("author", &di.Authors[i])
+	}
+	w.optional("program-used", di.ProgramUsed)
+	w.date(di.Date)
+	for _, u := range di.SrcURLs {
+		w.element("src-url", u)
+	}
+	w.optional("src-ocr", di.SrcOCR)
+	w.element("id", di.ID)
+	w.element("version", di.Version)
+	if len(di.History.Blocks) > 0 {
+		w.annotation("history", &di.History)
+	}
+	for i := range di.Publishers {
+		w.author("publisher", &di.Publishers[i])
+	}
+	w.end("document-info")
+}
+
+func (w *writer) publishInfo(pi *PublishInfo) {
+	if pi.BookName == "" && pi.Publisher == "" && pi.City == "" && pi.Year == "" &&
+		pi.ISBN == "" && len(pi.Sequences) == 0 {
+		return
+	}
+	w.start("publish-info")
+	w.optional("book-name", pi.BookName)
+	w.optional("publisher", pi.Publisher)
+	w.optional("city", pi.City)
+	w.optional("year", pi.Year)
+	w.optional("isbn", pi.ISBN)
+	w.sequences(pi.Sequences)
+	w.end("publish-info")
+}
+
+func (w *writer) annotation(name string, a *Annotation) {
+	w.start(name, "id", a.ID)
+	w.blocks(a.Blocks)
+	w.end(name)
+}
+
+func (w *writer) body(b *Body) {
+	w.start("body", "name", b.Name)
+	if b.Image != nil {
+		w.image(b.Image)
+	}
+	w.title(&b.Title)
+	for i := range b.Epigraphs {
+		w.epigraph(&b.Epigraphs[i])
+	}
+	for i := range b.Sections {
+		w.section(&b.Sections[i])
+	}
+	w.end("body")
+}
+
+// title writes a title unless it is empty.
+func (w *writer) title(t *Title) {
+	if len(t.Blocks) == 0 {
+		return
+	}
+	w.start("title")
+	w.blocks(t.Blocks)
+	w.end("title")
+}
+
+func (w *writer) section(s *Section) {
+	w.start("section", "id", s.ID)
+	w.title(&s.Title)
+	for i := range s.Epigraphs {
+		w.epigraph(&s.Epigraphs[i])
+	}
+	if s.Image != nil {
+		w.image(s.Image)
+	}
+	if s.Annotation != nil {
+		w.annotation("annotation", s.Annotation)
+	}
+	for i := range s.Sections {
+		w.section(&s.Sections[i])
+	}
+	w.blocks(s.Blocks)
+	w.end("section")
+}
+
+func (w *writer) blocks(blocks []Block) {
+	for _, b := range blocks {
+		switch b := b.(type) {
+		case *Paragraph:
+			w.paragraph("p", b)
+		case *Subtitle:
+			w.paragraph("subtitle", &b.Paragraph)
+		case *EmptyLine:
+			w.empty("empty-line")
+		case *Poem:
+			w.poem(b)
+		case *Cite:
+			w.start("cite", "id", b.ID)
+			w.blocks(b.Blocks)
+			w.textAuthors(b.TextAuthors)
+			w.end("cite")
+		case *Table:
+			w.table(b)
+		case *Image:
+			w.image(b)
+		default:
+			if w.err == nil {
+				w.err = fmt.Errorf("unsupported block %T", b)
+			}
+		}
+	}
+}
+
+func (w *writer) epigraph(e *Epigraph) {
+	w.start("epigraph", "id", e.ID)
+	w.blocks(e.Blocks)
+	w.textAuthors(e.TextAuthors)
+	w.end("epigraph")
+}
+
+func (w *writer) textAuthors(authors []Paragraph) {
+	for i := range authors {
+		w.paragraph("text-author", &authors[i])
+	}
+}
+
+func (w *writer) poem(p *Poem) {
+	w.start("poem", "id", p.ID)
+	if p.Title != nil {
+		w.title(p.Title)
+	}
+	for i := range p.Epigraphs {
+		w.epigraph(&p.Epigraphs[i])
+	}
+	for i := range p.Stanzas {
+		st := &p.Stanzas[i]
+		if len(st.Verses) == 0 && st.Title == nil && st.Subtitle != nil {
+			// A subtitle between stanzas, see Poem.UnmarshalXML.
+			w.paragraph("subtitle", &st.Subtitle.Paragraph)
+			continue
+		}
+		w.start("stanza")
+		if st.Title != nil {
+			w.title(st.Title)
+		}
+		if st.Subtitle != nil {
+			w.paragraph("subtitle", &st.Subtitle.Paragraph)
+		}
+		for j := range st.Verses {
+			w.paragraph("v", &st.Verses[j])
+		}
+		w.end("stanza")
+	}
+	w.textAuthors(p.TextAuthors)
+	w.optional("date", p.Date)
+	w.end("poem")
+}
+
+func (w *writer) table(t *Table) {
+	w.start("table", "id", t.ID)
+	for _, row := range t.Rows {
+		w.start("tr")
+		for i := range row.Cells {
+			c := &row.Cells[i]
+			name := "td"
+			if c.Header {
+				name = "th"
+			}
+			w.open(name, "id", c.ID, "style", c.Style, "colspan", c.ColSpan, "rowspan", c.RowSpan)
+			w.inlines(c.Inlines)
+			w.end(name)
+		}
+		w.end("tr")
+	}
+	w.end("table")
+}
+
+func (w *writer) image(img *Image) {
+	w.empty("image", "l:href", img.Href, "alt", img.Alt, "title", img.Title, "id", img.ID)
+}
+
+func (w *writer) paragraph(name string, p *Paragraph) {
+	w.open(name, "id", p.ID, "style", p.Style)
+	w.inlines(p.Inlines)
+	w.end(name)
+}
+
+func (w *writer) inlines(nodes []Inline) {
+	for i := range nodes {
+		n := &nodes[i]
+		switch n.Kind {
+		case InlineText:
+			w.text(n.Text)
+		case InlineImage:
+			w.raw("<image")
+			w.attrs([]string{"l:href", n.Href, "alt", n.Alt})
+			w.raw("/>")
+		default:
+			name := n.ElementName()
+			switch n.Kind {
+			case InlineLink:
+				w.open(name, "l:href", n.Href, "type", n.LinkType)
+			case InlineStyle:
+				w.open(name, "name", n.Name)
+			default:
+				w.open(name)
+			}
+			w.inlines(n.Children)
+			w.raw("</" + name + ">")
+		}
+	}
+}
+
+func (w *writer) binary(b *Binary) {
+	w.open("binary", "id", b.ID, "content-type", b.ContentType)
+	encoded := base64.StdEncoding.EncodeToString(b.Data)
+	for len(encoded) > binaryLineLength {
+		w.raw(encoded[:binaryLineLength] + "\n")
+		encoded = encoded[binaryLineLength:]
+	}
+	w.raw(encoded)
+	w.end("binary")
+}
@@ -0,0 +1,96 @@
+package fb2
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.fb2")
+	assert.NoError(t, err)
+	files = append(files, "testbook.xml")
+
+	for _, file := range files {
+		book := parseTestBook(t, file)
+
+		data, err := Marshal(book)
+		if !assert.NoError(t, err, file) {
+			continue
+		}
+		reparsed, err := ParseFictionBook(data)
+		if !assert.NoError(t, err, file) {
+			continue
+		}
+
+		assert.Equal(t, "utf-8", reparsed.Encoding, file)
+		reparsed.Encoding = book.Encoding
+		assert.Equal(t, book, reparsed, file)
+
+		// Writing is stable.
+		again, err := Marshal(reparsed)
+		assert.NoError(t, err, file)
+		assert.Equal(t, string(data), string(again), file)
+	}
+
+	// Empty lines of titles are kept.
+	book, err := ParseFictionBook([]byte(nestedBook))
+	assert.NoError(t, err)
+	data, err := Marshal(book)
+	assert.NoError(t, err)
+	reparsed, err := ParseFictionBook(data)
+	assert.NoError(t, err)
+	assert.Equal(t, book.Body.Title, reparsed.Body.Title)
+}
+
+func TestMarshalSyntheticBook(t *testing.T) {
+	book := &FictionBook{}
+	ti := &book.Description.TitleInfo
+	ti.Genres = []string{"sf"}
+	ti.GenreMatches = map[string]int{"sf": 90}
+	ti.Authors = []Author{{FirstName: "Иван", LastName: "Петров"}, {NickName: "ivan"}}
+	ti.BookTitle = "Книга & <компания>"
+	ti.Lang = "ru"
+	ti.Sequences = []Sequence{{Name: "Серия \"Звёзды\"", Number: "3"}}
+	ti.CoverPage.Images = []Image{{Href: "#cover.png"}}
+	book.Body.Sections = []Section{{
+		ID: "s1",
+		Blocks: []Block{
+			&Paragraph{Inlines: []Inline{
+				{Kind: InlineText, Text: "Текст "},
+				{Kind: InlineEmphasis, Children: []Inline{{Kind: InlineText, Text: "курсив"}}},
+				{Kind: InlineLink, Href: "#n1", LinkType: "note", Children: []Inline{{Kind: InlineText, Text: "1"}}},
+			}},
+			&EmptyLine{},
+		},
+	}}
+	book.NoteBodies = []Body{{Name: "notes", Sections: []Section{{ID: "n1", Blocks: []Block{
+		&Paragraph{Inlines: []Inline{{Kind: InlineText, Text: "Сноска"}}},
+	}}}}}
+	book.Binaries = []Binary{{ID: "cover.png", ContentType: "image/png", Data: bytes.Repeat([]byte{1, 2, 3}, 100)}}
+
+	data, err := Marshal(book)
+	assert.NoError(t, err)
+	doc := string(data)
+	assert.True(t, strings.HasPrefix(doc, `<?xml version="1.0" encoding="UTF-8"?>`))
+	assert.Contains(t, doc, `xmlns:l="http://www.w3.org/1999/xlink"`)
+	assert.Contains(t, doc, `<genre match="90">sf</genre>`)
+	assert.Contains(t, doc, `<book-title>Книга &amp; &lt;компания&gt;</book-title>`)
+	assert.Contains(t, doc, `<sequence name="Серия &quot;Звёзды&quot;" number="3"/>`)
+	assert.Contains(t, doc, `<image l:href="#cover.png"/>`)
+	assert.Contains(t, doc, `<p>Текст <emphasis>курсив</emphasis><a l:href="#n1" type="note">1</a></p>`)
+	assert.Contains(t, doc, `<body name="notes">`)
+	assert.Contains(t, doc, `<author>
+<nickname>ivan</nickname>
+</author>`)
+
+	parsed, err := ParseFictionBook(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "Книга & <компания>", parsed.Description.TitleInfo.BookTitle)
+	assert.Equal(t, book.Binaries, parsed.Binaries)
+	assert.Equal(t, "Сноска", NoteText(parsed.Note("#n1")))
+	assert.Equal(t, book.Body.Sections[0].Blocks, parsed.Body.Sections[0].Blocks)
+}
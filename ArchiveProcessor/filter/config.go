@@ -0,0 +1,216 @@
+package filter
+
+import (
+	"ArchiveProcessor/genre"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config describes a filter pipeline. It can be read from a JSON file with
+// the field names below; fields missing from the file keep their defaults.
+type Config struct {
+	Languages []string `json:"languages"`
+	// LanguagePolicy and MinLanguageConfidence are passed to LanguagesBy.
+	LanguagePolicy        LanguagePolicy `json:"language_policy"`
+	MinLanguageConfidence float64        `json:"min_language_confidence"`
+	IncludeGenres         []string       `json:"include_genres"`
+	ExcludeGenres         []string       `json:"exclude_genres"`
+	MinWords              int            `json:"min_words"`
+	MinYear               int            `json:"min_year"`
+	MaxYear               int            `json:"max_year"`
+	RequireAnnotation     bool           `json:"require_annotation"`
+	Sampling              []Class        `json:"sampling"`
+	// Seed selects the books kept by sampling, see Sample.
+	Seed uint64 `json:"seed"`
+}
+
+// DefaultConfig selects Russian books, keeping all science fiction and
+// fantasy and a quarter of the rest.
+func DefaultConfig() Config {
+	return Config{
+		Languages:             []string{"ru"},
+		LanguagePolicy:        PolicyTag,
+		MinLanguageConfidence: 0.5,
+		Sampling: []Class{
+			{
+				Name:   "fiction",
+				Genres: genre.SFGenres(),
+				Rate:   1,
+			},
+			{Name: "other", Rate: 0.25},
+		},
+	}
+}
+
+// LoadConfig reads a config file on top of the defaults.
+func LoadConfig(path string) (Config, error) {
+	c := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("error parsing filter config %s: %w", path, err)
+	}
+	if _, err := ParseLanguagePolicy(string(c.LanguagePolicy)); err != nil {
+		return c, fmt.Errorf("error parsing filter config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Pipeline builds the filters of the config. Cheap filters run first.
+func (c *Config) Pipeline() Pipeline {
+	var p Pipeline
+	if len(c.Languages) > 0 {
+		p = append(p, LanguagesBy(c.LanguagePolicy, c.MinLanguageConfidence, c.Languages...))
+	}
+	if len(c.IncludeGenres) > 0 || len(c.ExcludeGenres) > 0 {
+		p = append(p, Genres(c.IncludeGenres, c.ExcludeGenres))
+	}
+	if c.MinYear != 0 || c.MaxYear != 0 {
+		p = append(p, YearRange(c.MinYear, c.MaxYear))
+	}
+	if c.RequireAnnotation {
+		p = append(p, HasAnnotation())
+	}
+	if c.MinWords > 0 {
+		p = append(p, MinWords(c.MinWords))
+	}
+	if len(c.Sampling) > 0 {
+		p = append(p, Sample(c.Sampling, c.Seed))
+	}
+	return p
+}
+
+// Flags binds a Config to command line flags. Flags given on the command
+// line override the config file.
+type Flags struct {
+	fs *flag.FlagSet
+
+	configPath        string
+	languages         string
+	languagePolicy    string
+	minLangConfidence float64
+	includeGenres     string
+	excludeGenres     string
+	minWords          int
+	minYear           int
+	maxYear           int
+	requireAnnotation bool
+	sampleRates       string
+	seed              uint64
+}
+
+// RegisterFlags defines the filter flags on fs.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{fs: fs}
+	fs.StringVar(&f.configPath, "filter_config", "", "JSON filter config file")
+	fs.StringVar(&f.languages, "langs", "", "Comma separated languages to keep")
+	fs.StringVar(&f.languagePolicy, "lang_policy", string(PolicyTag), "Where the language comes from: tag, text or agree")
+	fs.Float64Var(&f.minLangConfidence, "min_lang_confidence", 0.5, "Minimum confidence of the language identified from the text")
+	fs.StringVar(&f.includeGenres, "include_genres", "", "Comma separated genres to keep, prefix* for prefixes, @group for groups")
+	fs.StringVar(&f.excludeGenres, "exclude_genres", "", "Comma separated genres to drop, prefix* for prefixes, @group for groups")
+	fs.IntVar(&f.minWords, "min_words", 0, "Minimum number of words in the body")
+	fs.IntVar(&f.minYear, "min_year", 0, "Minimum year of the book")
+	fs.IntVar(&f.maxYear, "max_year", 0, "Maximum year of the book")
+	fs.BoolVar(&f.requireAnnotation, "require_annotation", false, "Drop books without an annotation")
+	fs.StringVar(&f.sampleRates, "sample_rates", "", "Comma separated class=rate sampling rates, e.g. other=0.25")
+	fs.Uint64Var(&f.seed, "seed", 0, "Sampling seed")
+	return f
+}
+
+// Config returns the config file, or the defaults, with the flags set on
+// the command line applied.
+func (f *Flags) Config() (Config, error) {
+	c := DefaultConfig()
+	if f.configPath != "" {
+		var err error
+		if c, err = LoadConfig(f.configPath); err != nil {
+			return c, err
+		}
+	}
+
+	var err error
+	setErr := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "langs":
+			c.Languages = splitList(f.languages)
+		case "lang_policy":
+			policy, e := ParseLanguagePolicy(f.languagePolicy)
+			c.LanguagePolicy = policy
+			setErr(e)
+		case "min_lang_confidence":
+			c.MinLanguageConfidence = f.minLangConfidence
+		case "include_genres":
+			c.IncludeGenres = splitList(f.includeGenres)
+		case "exclude_genres":
+			c.ExcludeGenres = splitList(f.excludeGenres)
+		case "min_words":
+			c.MinWords = f.minWords
+		case "min_year":
+			c.MinYear = f.minYear
+		case "max_year":
+			c.MaxYear = f.maxYear
+		case "require_annotation":
+			c.RequireAnnotation = f.requireAnnotation
+		case "sample_rates":
+			setErr(setRates(c.Sampling, f.sampleRates))
+		case "seed":
+			c.Seed = f.seed
+		}
+	})
+	return c, err
+}
+
+// Save writes the config to path, in the format read by LoadConfig.
+func (c *Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func setRates(classes []Class, rates string) error {
+	for _, item := range splitList(rates) {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("invalid sampling rate %q, want class=rate", item)
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return fmt.Errorf("invalid sampling rate %q", item)
+		}
+
+		found := false
+		for i := range classes {
+			if classes[i].Name == name {
+				classes[i].Rate = rate
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown sampling class %q", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package filter
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultConfig(t *testing.T) {
+	c := DefaultConfig()
+	p := c.Pipeline()
+	assert.Equal(t, 2, len(p))
+	assert.Equal(t, "lang", p[0].Name())
+	assert.Equal(t, "sample", p[1].Name())
+
+	// Science fiction is always kept.
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, p.Accept(testBook("ru", "sf_space")))
+	}
+}
+
+func TestConfigFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filters.json")
+	err := os.WriteFile(path, []byte(`{"languages": ["ru", "uk"], "min_words": 1000, "require_annotation": true}`), 0644)
+	assert.NoError(t, err)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := RegisterFlags(fs)
+	err = fs.Parse([]string{
+		"-filter_config", path,
+		"-min_words", "500",
+		"-exclude_genres", "sf_horror, nonf*",
+		"-max_year", "2000",
+		"-sample_rates", "other=0.5",
+		"-seed", "7",
+		"-lang_policy", "agree",
+	})
+	assert.NoError(t, err)
+
+	c, err := f.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ru", "uk"}, c.Languages)
+	assert.Equal(t, 500, c.MinWords)
+	assert.True(t, c.RequireAnnotation)
+	assert.Equal(t, []string{"sf_horror", "nonf*"}, c.ExcludeGenres)
+	assert.Equal(t, 0, c.MinYear)
+	assert.Equal(t, 2000, c.MaxYear)
+	assert.Equal(t, 0.5, c.Sampling[1].Rate)
+	assert.Equal(t, uint64(7), c.Seed)
+	assert.Equal(t, PolicyAgree, c.LanguagePolicy)
+	assert.Equal(t, 0.5, c.MinLanguageConfidence)
+
+	var names []string
+	for _, filter := range c.Pipeline() {
+		names = append(names, filter.Name())
+	}
+	assert.Equal(t, []string{"lang", "genre", "year", "annotation", "min-words", "sample"}, names)
+}
+
+func TestConfigFlagErrors(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := RegisterFlags(fs)
+	assert.NoError(t, fs.Parse([]string{"-sample_rates", "poetry=0.5"}))
+	_, err := f.Config()
+	assert.EqualError(t, err, `unknown sampling class "poetry"`)
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	f = RegisterFlags(fs)
+	assert.NoError(t, fs.Parse([]string{"-lang_policy", "both", "-sample_rates", "other=0.5"}))
+	_, err = f.Config()
+	assert.EqualError(t, err, `unknown language policy "both", want tag, text or agree`)
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	f = RegisterFlags(fs)
+	assert.NoError(t, fs.Parse([]string{"-filter_config", "missing.json"}))
+	_, err = f.Config()
+	assert.Error(t, err)
+}
+
+func TestConfigSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filters.json")
+	c := DefaultConfig()
+	c.Seed = 12345
+	c.Sampling[1].Rate = 0.1
+	assert.NoError(t, c.Save(path))
+
+	loaded, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, c, loaded)
+}
@@ -0,0 +1,326 @@
+// Package filter selects the books that go into a dataset. Filters are
+// combined into a Pipeline, usually built from a Config.
+package filter
+
+import (
+	"ArchiveProcessor/fb2"
+	"ArchiveProcessor/genre"
+	"ArchiveProcessor/langid"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// Book is what filters look at: the parsed book and its record, with the
+// body not yet truncated.
+type Book struct {
+	*fb2.FictionBook
+	Record fb2.Record
+
+	// Key identifies the book across runs, such as archive/entry. Sampling
+	// decisions are derived from it.
+	Key string
+}
+
+// Filter decides whether a book goes into the dataset.
+type Filter interface {
+	// Name identifies the filter in rejection errors.
+	Name() string
+	// Accept returns nil if the book passes, or an error saying why it was
+	// rejected.
+	Accept(book *Book) error
+}
+
+// fullTextFilter is implemented by filters that need the whole text of the
+// book rather than the part read for the record.
+type fullTextFilter interface {
+	needsFullText() bool
+}
+
+// Rejection is the error returned by Pipeline.Accept, naming the filter that
+// rejected the book.
+type Rejection struct {
+	Filter string
+	Err    error
+}
+
+func (r *Rejection) Error() string { return r.Filter + ": " + r.Err.Error() }
+
+func (r *Rejection) Unwrap() error { return r.Err }
+
+// Pipeline runs filters in order and stops at the first rejection.
+type Pipeline []Filter
+
+func (p Pipeline) Accept(book *Book) error {
+	for _, f := range p {
+		if err := f.Accept(book); err != nil {
+			return &Rejection{Filter: f.Name(), Err: err}
+		}
+	}
+	return nil
+}
+
+// NeedsFullText reports whether a filter looks at the whole text, in which
+// case books must be parsed without a text limit.
+func (p Pipeline) NeedsFullText() bool {
+	for _, f := range p {
+		if ft, ok := f.(fullTextFilter); ok && ft.needsFullText() {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchGenre reports whether a genre code matches a pattern, see genre.Match.
+func MatchGenre(pattern, code string) bool {
+	return genre.Match(pattern, code)
+}
+
+// LanguagePolicy says where the language of a book is taken from.
+type LanguagePolicy string
+
+const (
+	// PolicyTag trusts the <lang> tag of the title-info.
+	PolicyTag LanguagePolicy = "tag"
+	// PolicyText uses the language identified from the body text.
+	PolicyText LanguagePolicy = "text"
+	// PolicyAgree requires the tag and the body text to agree.
+	PolicyAgree LanguagePolicy = "agree"
+)
+
+// ParseLanguagePolicy returns the policy named s.
+func ParseLanguagePolicy(s string) (LanguagePolicy, error) {
+	switch p := LanguagePolicy(s); p {
+	case PolicyTag, PolicyText, PolicyAgree:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown language policy %q, want tag, text or agree", s)
+}
+
+type languages struct {
+	set           map[string]bool
+	policy        LanguagePolicy
+	minConfidence float64
+}
+
+// Languages accepts books whose title-info language is one of langs. Tags
+// are compared after langid.NormalizeTag, so RU, ru-RU and rus all match ru.
+func Languages(langs ...string) Filter {
+	return LanguagesBy(PolicyTag, 0, langs...)
+}
+
+// LanguagesBy accepts books whose language, as decided by policy, is one of
+// langs. With PolicyText and PolicyAgree the body text must be identified
+// with at least minConfidence.
+func LanguagesBy(policy LanguagePolicy, minConfidence float64, langs ...string) Filter {
+	l := &languages{set: make(map[string]bool), policy: policy, minConfidence: minConfidence}
+	for _, lang := range langs {
+		l.set[langid.NormalizeTag(lang)] = true
+	}
+	return l
+}
+
+func (l *languages) Name() string { return "lang" }
+
+func (l *languages) Accept(book *Book) error {
+	tag := langid.NormalizeTag(book.Description.TitleInfo.Lang)
+	if l.policy != PolicyText && !l.set[tag] {
+		return fmt.Errorf("language %q not selected", tag)
+	}
+	if l.policy == PolicyTag {
+		return nil
+	}
+
+	detected := detectLanguage(book)
+	switch {
+	case detected.Lang == "":
+		return fmt.Errorf("no text to identify the language of")
+	case detected.Confidence < l.minConfidence:
+		return fmt.Errorf("detected language %q with confidence %.2f below %.2f",
+			detected.Lang, detected.Confidence, l.minConfidence)
+	case l.policy == PolicyText && !l.set[detected.Lang]:
+		return fmt.Errorf("detected language %q not selected", detected.Lang)
+	case l.policy == PolicyAgree && detected.Lang != tag:
+		return fmt.Errorf("language tag %q but detected %q", tag, detected.Lang)
+	}
+	return nil
+}
+
+// detectLanguage returns the language identified from the body, running the
+// identifier if the caller has not filled in the record.
+func detectLanguage(book *Book) langid.Result {
+	if book.Record.DetectedLang == "" {
+		r := langid.Default().Identify(book.Record.Body)
+		book.Record.DetectedLang, book.Record.LangConfidence = r.Lang, r.Confidence
+	}
+	return langid.Result{Lang: book.Record.DetectedLang, Confidence: book.Record.LangConfidence}
+}
+
+type genres struct {
+	include, exclude []string
+}
+
+// Genres accepts books with a genre matching one of the include patterns, or
+// any books if there are none, unless a genre matches one of the exclude
+// patterns. See MatchGenre for the patterns.
+func Genres(include, exclude []string) Filter {
+	return &genres{include: include, exclude: exclude}
+}
+
+func (g *genres) Name() string { return "genre" }
+
+func (g *genres) Accept(book *Book) error {
+	codes := book.Description.TitleInfo.Genres
+	if code, ok := genre.MatchAny(g.exclude, codes); ok {
+		return fmt.Errorf("genre %s excluded", code)
+	}
+	if len(g.include) > 0 {
+		if _, ok := genre.MatchAny(g.include, codes); !ok {
+			return fmt.Errorf("no selected genre in %s", strings.Join(codes, ","))
+		}
+	}
+	return nil
+}
+
+type minWords int
+
+// MinWords accepts books with at least n words in the body.
+func MinWords(n int) Filter {
+	return minWords(n)
+}
+
+func (m minWords) Name() string { return "min-words" }
+
+func (m minWords) needsFullText() bool { return true }
+
+func (m minWords) Accept(book *Book) error {
+	if n := CountWords(book.Record.Body); n < int(m) {
+		return fmt.Errorf("%d words, want at least %d", n, int(m))
+	}
+	return nil
+}
+
+// CountWords counts the runs of letters and digits in text.
+func CountWords(text string) int {
+	n := 0
+	inWord := false
+	for _, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && !inWord {
+			n++
+		}
+		inWord = isWord
+	}
+	return n
+}
+
+type yearRange struct {
+	min, max int
+}
+
+// YearRange accepts books written, or failing that published, between min
+// and max inclusive. Zero leaves a bound open. Books without a year are
+// rejected.
+func YearRange(min, max int) Filter {
+	return &yearRange{min: min, max: max}
+}
+
+func (y *yearRange) Name() string { return "year" }
+
+func (y *yearRange) Accept(book *Book) error {
+	year, ok := book.Description.TitleInfo.Date.Year()
+	if !ok {
+		year, ok = book.Description.PublishInfo.PublishYear()
+	}
+	switch {
+	case !ok:
+		return fmt.Errorf("no year")
+	case y.min != 0 && year < y.min, y.max != 0 && year > y.max:
+		return fmt.Errorf("year %d out of range", year)
+	}
+	return nil
+}
+
+type hasAnnotation struct{}
+
+// HasAnnotation accepts books with a non-empty annotation.
+func HasAnnotation() Filter {
+	return hasAnnotation{}
+}
+
+func (hasAnnotation) Name() string { return "annotation" }
+
+func (hasAnnotation) Accept(book *Book) error {
+	if strings.TrimSpace(book.Record.Annotation) == "" {
+		return fmt.Errorf("no annotation")
+	}
+	return nil
+}
+
+// Class is a group of books sampled at the same rate. A class without genres
+// holds the books not in any other class.
+type Class struct {
+	Name   string   `json:"name"`
+	Genres []string `json:"genres,omitempty"`
+	Rate   float64  `json:"rate"`
+}
+
+type sample struct {
+	classes []Class
+	seed    uint64
+}
+
+// Sample keeps each book with the rate of its class, the first one with a
+// genre matching the book. Books outside of every class are kept. Whether a
+// book is kept depends only on its key and the seed, so runs with the same
+// seed select the same books.
+func Sample(classes []Class, seed uint64) Filter {
+	return &sample{classes: classes, seed: seed}
+}
+
+func (s *sample) Name() string { return "sample" }
+
+// Class returns the class of a book, or nil.
+func (s *sample) class(book *Book) *Class {
+	var fallback *Class
+	for i := range s.classes {
+		c := &s.classes[i]
+		if len(c.Genres) == 0 {
+			if fallback == nil {
+				fallback = c
+			}
+			continue
+		}
+		if _, ok := genre.MatchAny(c.Genres, book.Description.TitleInfo.Genres); ok {
+			return c
+		}
+	}
+	return fallback
+}
+
+func (s *sample) Accept(book *Book) error {
+	c := s.class(book)
+	if c == nil || c.Rate >= 1 {
+		return nil
+	}
+	if SampleValue(book.Key, s.seed) >= c.Rate {
+		return fmt.Errorf("not sampled from class %s", c.Name)
+	}
+	return nil
+}
+
+// SampleValue maps a key and a seed to a number in [0, 1), uniformly
+// distributed over keys.
+func SampleValue(key string, seed uint64) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// The splitmix64 finalizer spreads the FNV hash and the seed over all
+	// bits.
+	x := h.Sum64() ^ seed
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
+}
@@ -0,0 +1,167 @@
+package filter
+
+import (
+	"ArchiveProcessor/fb2"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testBook(lang string, genres ...string) *Book {
+	book := &fb2.FictionBook{}
+	book.Description.TitleInfo.Lang = lang
+	book.Description.TitleInfo.Genres = genres
+	return &Book{FictionBook: book}
+}
+
+func TestMatchGenre(t *testing.T) {
+	assert.True(t, MatchGenre("sf*", "sf_social"))
+	assert.True(t, MatchGenre("sf*", "sf"))
+	assert.True(t, MatchGenre("sf", "sf"))
+	assert.False(t, MatchGenre("sf", "sf_social"))
+	assert.False(t, MatchGenre("sf*", "child_sf"))
+}
+
+func TestLanguages(t *testing.T) {
+	f := Languages("ru", "UK")
+	assert.NoError(t, f.Accept(testBook("ru")))
+	assert.NoError(t, f.Accept(testBook(" uk\n")))
+	assert.NoError(t, f.Accept(testBook("ru-RU")))
+	assert.NoError(t, f.Accept(testBook("rus")))
+	assert.EqualError(t, f.Accept(testBook("en")), `language "en" not selected`)
+}
+
+func TestLanguagesBy(t *testing.T) {
+	const ru = "Он долго стоял у окна и смотрел, как над городом медленно поднимается солнце."
+	const uk = "Він довго стояв біля вікна і дивився, як над містом повільно піднімається сонце."
+	book := func(lang, body string) *Book {
+		b := testBook(lang)
+		b.Record.Body = body
+		return b
+	}
+
+	f := LanguagesBy(PolicyText, 0.5, "ru")
+	assert.NoError(t, f.Accept(book("", ru)))
+	assert.NoError(t, f.Accept(book("uk", ru)))
+	assert.EqualError(t, f.Accept(book("ru", uk)), `detected language "uk" not selected`)
+	assert.EqualError(t, f.Accept(book("ru", "")), "no text to identify the language of")
+
+	f = LanguagesBy(PolicyAgree, 0.5, "ru", "uk")
+	assert.NoError(t, f.Accept(book("ru", ru)))
+	assert.NoError(t, f.Accept(book("UK", uk)))
+	assert.EqualError(t, f.Accept(book("ru", uk)), `language tag "ru" but detected "uk"`)
+	assert.EqualError(t, f.Accept(book("en", ru)), `language "en" not selected`)
+
+	// A detection already in the record is used as is.
+	b := book("ru", ru)
+	b.Record.DetectedLang, b.Record.LangConfidence = "ru", 0.3
+	assert.EqualError(t, f.Accept(b), `detected language "ru" with confidence 0.30 below 0.50`)
+
+	_, err := ParseLanguagePolicy("both")
+	assert.Error(t, err)
+}
+
+func TestGenres(t *testing.T) {
+	f := Genres([]string{"sf*", "det_classic"}, []string{"sf_horror"})
+	assert.NoError(t, f.Accept(testBook("ru", "prose", "sf_social")))
+	assert.NoError(t, f.Accept(testBook("ru", "det_classic")))
+	assert.EqualError(t, f.Accept(testBook("ru", "det_police")), "no selected genre in det_police")
+	assert.EqualError(t, f.Accept(testBook("ru", "sf", "sf_horror")), "genre sf_horror excluded")
+
+	f = Genres(nil, []string{"nonf*"})
+	assert.NoError(t, f.Accept(testBook("ru", "prose")))
+	assert.Error(t, f.Accept(testBook("ru", "nonf_biography")))
+}
+
+func TestMinWords(t *testing.T) {
+	assert.Equal(t, 4, CountWords("Раз, два — три!\n4"))
+	assert.Equal(t, 0, CountWords(" — "))
+
+	book := testBook("ru")
+	book.Record.Body = "один два три"
+	assert.NoError(t, MinWords(3).Accept(book))
+	assert.EqualError(t, MinWords(4).Accept(book), "3 words, want at least 4")
+}
+
+func TestYearRange(t *testing.T) {
+	book := testBook("ru")
+	f := YearRange(1950, 1999)
+	assert.EqualError(t, f.Accept(book), "no year")
+
+	book.Description.PublishInfo.Year = "1985"
+	assert.NoError(t, f.Accept(book))
+
+	// The title-info date takes precedence.
+	book.Description.TitleInfo.Date = fb2.Date{Text: "1930"}
+	assert.EqualError(t, f.Accept(book), "year 1930 out of range")
+	assert.NoError(t, YearRange(0, 1950).Accept(book))
+}
+
+func TestHasAnnotation(t *testing.T) {
+	book := testBook("ru")
+	assert.Error(t, HasAnnotation().Accept(book))
+	book.Record.Annotation = "Аннотация"
+	assert.NoError(t, HasAnnotation().Accept(book))
+}
+
+func TestSample(t *testing.T) {
+	f := Sample([]Class{
+		{Name: "fiction", Genres: []string{"sf*"}, Rate: 1},
+		{Name: "other", Rate: 0.25},
+		{Name: "detective", Genres: []string{"det*"}, Rate: 0},
+	}, 42)
+
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("f.fb2-%d.zip/%d.fb2", i/1000, i)
+		fiction := testBook("ru", "sf_social")
+		fiction.Key = key
+		assert.NoError(t, f.Accept(fiction))
+		detective := testBook("ru", "det_police")
+		detective.Key = key
+		assert.EqualError(t, f.Accept(detective), "not sampled from class detective")
+
+		other := testBook("ru", "prose")
+		other.Key = key
+		err := f.Accept(other)
+		if err == nil {
+			kept++
+		} else {
+			assert.EqualError(t, err, "not sampled from class other")
+		}
+		// The same book is always selected the same way.
+		assert.Equal(t, err, f.Accept(other))
+	}
+	assert.InDelta(t, 2500, kept, 150)
+}
+
+func TestSampleValue(t *testing.T) {
+	assert.Equal(t, SampleValue("a.zip/1.fb2", 1), SampleValue("a.zip/1.fb2", 1))
+	assert.NotEqual(t, SampleValue("a.zip/1.fb2", 1), SampleValue("a.zip/1.fb2", 2))
+	assert.NotEqual(t, SampleValue("a.zip/1.fb2", 1), SampleValue("a.zip/2.fb2", 1))
+
+	// Different seeds select different books.
+	same := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("a.zip/%d.fb2", i)
+		if (SampleValue(key, 1) < 0.5) == (SampleValue(key, 2) < 0.5) {
+			same++
+		}
+	}
+	assert.InDelta(t, 500, same, 60)
+}
+
+func TestPipeline(t *testing.T) {
+	p := Pipeline{Languages("ru"), Genres(nil, []string{"sf_horror"})}
+	assert.NoError(t, p.Accept(testBook("ru", "sf")))
+	assert.EqualError(t, p.Accept(testBook("en", "sf")), `lang: language "en" not selected`)
+	assert.EqualError(t, p.Accept(testBook("ru", "sf_horror")), "genre: genre sf_horror excluded")
+
+	var r *Rejection
+	assert.ErrorAs(t, p.Accept(testBook("ru", "sf_horror")), &r)
+	assert.Equal(t, "genre", r.Filter)
+
+	assert.False(t, p.NeedsFullText())
+	assert.True(t, append(p, MinWords(10)).NeedsFullText())
+}
@@ -0,0 +1,116 @@
+package genre
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Match reports whether a genre code matches a pattern, after both are
+// normalized with the default catalogue. A pattern starting with @ matches
+// the genres of that group, a pattern ending in * matches codes starting
+// with the rest of it, any other pattern has to match the code exactly.
+func Match(pattern, code string) bool {
+	c := Default()
+	if group, ok := strings.CutPrefix(pattern, "@"); ok {
+		g, known := c.Lookup(code)
+		return known && g.Group == group
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(c.Normalize(code), clean(prefix)) || strings.HasPrefix(clean(code), clean(prefix))
+	}
+	return c.Normalize(code) == c.Normalize(pattern)
+}
+
+// Class is a coarse class of books, such as sf or nonfiction.
+type Class struct {
+	Name string `json:"name"`
+	// Genres are patterns as accepted by Match. A class without patterns
+	// takes the books that fit no other class.
+	Genres []string `json:"genres,omitempty"`
+}
+
+// SFGenres are the genres counted as science fiction and fantasy.
+func SFGenres() []string {
+	return []string{"@sf", "sf*", "child_sf", "love_sf"}
+}
+
+// DefaultClasses are the classes used unless a classes file is given. The
+// first matching class wins, so the order matters: a detective story for
+// children is a detective, a fantasy love story is sf.
+func DefaultClasses() []Class {
+	return []Class{
+		{Name: "sf", Genres: SFGenres()},
+		{Name: "detective", Genres: []string{"@detective", "child_det", "love_detective"}},
+		{Name: "romance", Genres: []string{"@love"}},
+		{Name: "adventure", Genres: []string{"@adventure", "child_adv"}},
+		{Name: "children", Genres: []string{"@children"}},
+		{Name: "prose", Genres: []string{"@prose", "@poetry", "@antique", "@humor", "@folklore"}},
+		{Name: "nonfiction", Genres: []string{"@science", "@computers", "@reference", "@nonfiction",
+			"@religion", "@home", "@economy", "@technics", "@military"}},
+		{Name: "other"},
+	}
+}
+
+// LoadClasses reads a JSON list of classes.
+func LoadClasses(path string) ([]Class, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var classes []Class
+	if err := json.Unmarshal(data, &classes); err != nil {
+		return nil, fmt.Errorf("error parsing genre classes %s: %w", path, err)
+	}
+	return classes, nil
+}
+
+// Classifier puts books into classes by their genres.
+type Classifier struct {
+	classes []Class
+}
+
+// NewClassifier returns a classifier for classes, tried in order.
+func NewClassifier(classes []Class) *Classifier {
+	return &Classifier{classes: classes}
+}
+
+// Class returns the first class with a pattern matching one of codes, the
+// first class without patterns if there is none, or nil.
+func (c *Classifier) Class(codes []string) *Class {
+	var fallback *Class
+	for i := range c.classes {
+		class := &c.classes[i]
+		if len(class.Genres) == 0 {
+			if fallback == nil {
+				fallback = class
+			}
+			continue
+		}
+		if _, ok := MatchAny(class.Genres, codes); ok {
+			return class
+		}
+	}
+	return fallback
+}
+
+// Classify returns the name of the class of codes, or "".
+func (c *Classifier) Classify(codes []string) string {
+	if class := c.Class(codes); class != nil {
+		return class.Name
+	}
+	return ""
+}
+
+// MatchAny returns the first of codes matching one of patterns.
+func MatchAny(patterns, codes []string) (string, bool) {
+	for _, code := range codes {
+		for _, pattern := range patterns {
+			if Match(pattern, code) {
+				return code, true
+			}
+		}
+	}
+	return "", false
+}
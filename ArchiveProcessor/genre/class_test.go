@@ -0,0 +1,54 @@
+package genre
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	assert.True(t, Match("sf*", "sf_social"))
+	assert.True(t, Match("sf*", "SF"))
+	assert.True(t, Match("sf", "sf"))
+	assert.False(t, Match("sf", "sf_social"))
+	assert.False(t, Match("sf*", "child_sf"))
+
+	// Aliases match their genre.
+	assert.True(t, Match("popadanec", "popadancy"))
+	assert.True(t, Match("popadancy*", "popadancy"))
+
+	assert.True(t, Match("@sf", "litrpg"))
+	assert.True(t, Match("@sf", "popadancy"))
+	assert.False(t, Match("@sf", "child_sf"))
+	assert.False(t, Match("@sf", "sf_unknown"))
+}
+
+func TestClassifier(t *testing.T) {
+	c := NewClassifier(DefaultClasses())
+	assert.Equal(t, "sf", c.Classify([]string{"prose_contemporary", "hronoopera"}))
+	assert.Equal(t, "sf", c.Classify([]string{"child_sf"}))
+	assert.Equal(t, "detective", c.Classify([]string{"child_det"}))
+	assert.Equal(t, "nonfiction", c.Classify([]string{"sci_history"}))
+	assert.Equal(t, "prose", c.Classify([]string{"prose_classic"}))
+	assert.Equal(t, "other", c.Classify([]string{"xyz"}))
+	assert.Equal(t, "other", c.Classify(nil))
+
+	c = NewClassifier([]Class{{Name: "sf", Genres: []string{"@sf"}}})
+	assert.Equal(t, "", c.Classify([]string{"love"}))
+}
+
+func TestLoadClasses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "classes.json")
+	err := os.WriteFile(path, []byte(`[{"name": "fantasy", "genres": ["sf_fantasy*", "@love"]}, {"name": "rest"}]`), 0644)
+	assert.NoError(t, err)
+
+	classes, err := LoadClasses(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []Class{{Name: "fantasy", Genres: []string{"sf_fantasy*", "@love"}}, {Name: "rest"}}, classes)
+	assert.Equal(t, "fantasy", NewClassifier(classes).Classify([]string{"love_sf"}))
+
+	_, err = LoadClasses(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
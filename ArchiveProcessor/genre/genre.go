@@ -0,0 +1,243 @@
+// Package genre knows the FB2 and Flibusta genre codes: their Russian names,
+// the groups they belong to and the misspelled codes found in the wild. It
+// also maps genres to coarse classes, see Classifier.
+package genre
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed genres.tsv
+var genresTSV []byte
+
+var (
+	defaultOnce      sync.Once
+	defaultCatalogue *Catalogue
+)
+
+// Default returns the catalogue read from the bundled genres.tsv.
+func Default() *Catalogue {
+	defaultOnce.Do(func() {
+		c, err := Parse(bytes.NewReader(genresTSV))
+		if err != nil {
+			panic(fmt.Sprintf("bundled genres.tsv: %+v", err))
+		}
+		defaultCatalogue = c
+	})
+	return defaultCatalogue
+}
+
+// Group is a top level genre group, such as Фантастика.
+type Group struct {
+	Code string
+	Name string
+}
+
+// Genre is a genre code with its display name and group.
+type Genre struct {
+	Code  string
+	Name  string
+	Group string
+}
+
+// Catalogue holds the known genres.
+type Catalogue struct {
+	groups  []Group
+	genres  []Genre
+	byCode  map[string]int
+	aliases map[string]string
+}
+
+// Parse reads a catalogue in the format of genres.tsv.
+func Parse(r io.Reader) (*Catalogue, error) {
+	c := &Catalogue{byCode: make(map[string]int), aliases: make(map[string]string)}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: want code and name", line)
+		}
+
+		if code, ok := strings.CutPrefix(fields[0], "@"); ok {
+			c.groups = append(c.groups, Group{Code: code, Name: fields[1]})
+			continue
+		}
+		if len(c.groups) == 0 {
+			return nil, fmt.Errorf("line %d: genre %s outside of a group", line, fields[0])
+		}
+		if _, ok := c.byCode[fields[0]]; ok {
+			return nil, fmt.Errorf("line %d: duplicate genre %s", line, fields[0])
+		}
+		c.byCode[fields[0]] = len(c.genres)
+		c.genres = append(c.genres, Genre{Code: fields[0], Name: fields[1], Group: c.groups[len(c.groups)-1].Code})
+		if len(fields) > 2 {
+			for _, alias := range strings.Split(fields[2], ",") {
+				c.aliases[strings.TrimSpace(alias)] = fields[0]
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for alias, code := range c.aliases {
+		if _, ok := c.byCode[alias]; ok {
+			return nil, fmt.Errorf("alias %s of %s is a genre", alias, code)
+		}
+	}
+	return c, nil
+}
+
+// Groups returns the groups in catalogue order.
+func (c *Catalogue) Groups() []Group {
+	return c.groups
+}
+
+// Genres returns the genres in catalogue order.
+func (c *Catalogue) Genres() []Genre {
+	return c.genres
+}
+
+// clean lower-cases a code as found in <genre> and turns dashes and spaces
+// into underscores.
+func clean(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, code)
+}
+
+// Lookup returns the genre of a code, resolving aliases.
+func (c *Catalogue) Lookup(code string) (Genre, bool) {
+	code = clean(code)
+	if alias, ok := c.aliases[code]; ok {
+		code = alias
+	}
+	i, ok := c.byCode[code]
+	if !ok {
+		return Genre{}, false
+	}
+	return c.genres[i], true
+}
+
+// Normalize returns the catalogue code of a genre, or the cleaned up code
+// if it is unknown.
+func (c *Catalogue) Normalize(code string) string {
+	if g, ok := c.Lookup(code); ok {
+		return g.Code
+	}
+	return clean(code)
+}
+
+// NormalizeAll normalizes codes, dropping empty and repeated ones.
+func (c *Catalogue) NormalizeAll(codes []string) []string {
+	normalized := make([]string, 0, len(codes))
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		code = c.Normalize(code)
+		if code != "" && !seen[code] {
+			seen[code] = true
+			normalized = append(normalized, code)
+		}
+	}
+	return normalized
+}
+
+// Names returns the display names of codes. Unknown codes are kept as is.
+func (c *Catalogue) Names(codes []string) []string {
+	names := make([]string, 0, len(codes))
+	for _, code := range codes {
+		if g, ok := c.Lookup(code); ok {
+			names = append(names, g.Name)
+		} else {
+			names = append(names, code)
+		}
+	}
+	return names
+}
+
+// Unknown counts the genre codes missing from a catalogue. It is safe for
+// concurrent use.
+type Unknown struct {
+	catalogue *Catalogue
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// NewUnknown returns an empty count of codes unknown to c.
+func NewUnknown(c *Catalogue) *Unknown {
+	return &Unknown{catalogue: c, counts: make(map[string]int)}
+}
+
+// Add counts the unknown codes of a book and returns them.
+func (u *Unknown) Add(codes []string) []string {
+	var unknown []string
+	for _, code := range codes {
+		if _, ok := u.catalogue.Lookup(code); !ok && clean(code) != "" {
+			unknown = append(unknown, clean(code))
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, code := range unknown {
+		u.counts[code]++
+	}
+	return unknown
+}
+
+// Counts returns the unknown codes with the number of books they were seen
+// in, most frequent first.
+func (u *Unknown) Counts() []CodeCount {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	counts := make([]CodeCount, 0, len(u.counts))
+	for code, n := range u.counts {
+		counts = append(counts, CodeCount{Code: code, Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Code < counts[j].Code
+	})
+	return counts
+}
+
+// CodeCount is a genre code with a number of books.
+type CodeCount struct {
+	Code  string
+	Count int
+}
+
+// Print writes the unknown codes, if any, to w.
+func (u *Unknown) Print(w io.Writer) {
+	counts := u.Counts()
+	if len(counts) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Unknown genre codes: %d\n", len(counts))
+	for _, c := range counts {
+		fmt.Fprintf(w, "  %-30s %d\n", c.Code, c.Count)
+	}
+}
@@ -0,0 +1,59 @@
+package genre
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault(t *testing.T) {
+	c := Default()
+	assert.Greater(t, len(c.Genres()), 150)
+	assert.Equal(t, "sf", c.Groups()[0].Code)
+
+	g, ok := c.Lookup("sf_space")
+	assert.True(t, ok)
+	assert.Equal(t, Genre{Code: "sf_space", Name: "Космическая фантастика", Group: "sf"}, g)
+
+	// Every genre of the testdata books is known.
+	for _, code := range []string{"sf", "sf_social", "det_espionage", "child_det", "sci_history"} {
+		_, ok := c.Lookup(code)
+		assert.True(t, ok, code)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	c := Default()
+	assert.Equal(t, "popadanec", c.Normalize("popadancy"))
+	assert.Equal(t, "popadanec", c.Normalize(" Popadanec\n"))
+	assert.Equal(t, "sf_stimpank", c.Normalize("sf-steampunk"))
+	assert.Equal(t, "unknown_code", c.Normalize("Unknown-Code"))
+
+	assert.Equal(t, []string{"popadanec", "sf"}, c.NormalizeAll([]string{"popadancy", "popadanec", "", "SF"}))
+	assert.Equal(t, []string{"Попаданцы", "xyz"}, c.Names([]string{"popadancy", "xyz"}))
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse(strings.NewReader("sf\tФантастика\n"))
+	assert.EqualError(t, err, "line 1: genre sf outside of a group")
+
+	_, err = Parse(strings.NewReader("@sf\tФантастика\nsf\tНФ\nsf\tНФ\n"))
+	assert.EqualError(t, err, "line 3: duplicate genre sf")
+
+	_, err = Parse(strings.NewReader("@sf\tФантастика\nsf\tНФ\tsf_fantasy\nsf_fantasy\tФэнтези\n"))
+	assert.EqualError(t, err, "alias sf_fantasy of sf is a genre")
+}
+
+func TestUnknown(t *testing.T) {
+	u := NewUnknown(Default())
+	assert.Nil(t, u.Add([]string{"sf", "popadancy"}))
+	assert.Equal(t, []string{"sf_xyz"}, u.Add([]string{"sf", "SF_XYZ"}))
+	u.Add([]string{"sf_xyz", "abc"})
+	assert.Equal(t, []CodeCount{{"sf_xyz", 2}, {"abc", 1}}, u.Counts())
+
+	var buf bytes.Buffer
+	u.Print(&buf)
+	assert.Contains(t, buf.String(), "Unknown genre codes: 2\n")
+}
@@ -3,6 +3,8 @@ module ArchiveProcessor
 go 1.21rc2
 
 require (
+	github.com/blevesearch/snowballstem v0.9.0
+	github.com/google/flatbuffers v24.3.25+incompatible
 	github.com/schollz/progressbar/v3 v3.13.1
 	github.com/stretchr/testify v1.8.4
 	gonum.org/v1/hdf5 v0.0.0-20210714002203-8c5d23bc6946
@@ -13,7 +15,6 @@ require (
 	github.com/antchfx/xpath v0.0.0-20170515025933-1f3266e77307 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/go-sql-driver/mysql v1.7.1 // indirect
-	github.com/liderman/rustemmer v0.3.0 // indirect
 	github.com/mattn/go-runewidth v0.0.14 // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"ArchiveProcessor/fb2"
+	"ArchiveProcessor/genre"
+	"ArchiveProcessor/sink"
 	"bufio"
 	"encoding/csv"
 	"encoding/json"
@@ -22,6 +25,10 @@ var positiveSamples string
 var negativesSamples string
 var matchedPositivesOutput string
 var fieldsToExtract string
+var genreClassesPath string
+
+var classifier *genre.Classifier
+var unknownGenres = genre.NewUnknown(genre.Default())
 
 type Task struct {
 	Body      string
@@ -35,24 +42,10 @@ type Result struct {
 	MatchedPositive string
 }
 
-// Author represents the author of the book.
-type Author struct {
-	FirstName  string `json:"first_name"`
-	LastName   string `json:"last_name"`
-	MiddleName string `json:"middle_name"`
-	NickName   string `json:"nick_name"`
-}
-
-// Book represents the book details.
+// Book is a record written by archive-processor, labelled for selection.
 type Book struct {
-	ID         string   `json:"id"`
-	Genre      []string `json:"genre"`
-	Author     []Author `json:"author"`
-	BookTitle  string   `json:"book_title"`
-	Body       string   `json:"body"`
-	Annotation string   `json:"annotation"`
-	FileName   string   `json:"file_name"`
-	IsSelected string   `json:"is_selected"`
+	fb2.Record
+	IsSelected string `json:"is_selected"`
 }
 
 func getFiles(fileName string) []string {
@@ -80,38 +73,14 @@ func getFiles(fileName string) []string {
 
 // CSVRecord converts the Book struct into a slice of strings suitable for CSV
 // output.
-// TODO: keep in sync with CSVHeader
 func (b *Book) CSVRecord() []string {
-	authors := make([]string, 0, len(b.Author))
-	for _, author := range b.Author {
-		authors = append(authors, fmt.Sprintf("%s %s", author.FirstName, author.LastName))
-	}
-
-	return []string{
-		b.ID,
-		strings.Join(b.Genre, ";"),
-		strings.Join(authors, ";"),
-		b.BookTitle,
-		b.Body,
-		b.Annotation,
-		b.FileName,
-		b.IsSelected,
-	}
+	return append(sink.Columns{}.Row(&b.Record), b.IsSelected)
 }
 
-// CSVHeader returns the header for the CSV file.
-// TODO: keep in sync with Book.CSVRecord
+// CSVHeader returns the header for the CSV file, the default columns of
+// archive-processor's tabular formats and the label.
 func CSVHeader() []string {
-	return []string{
-		"ID",
-		"Genres",
-		"Authors",
-		"BookTitle",
-		"Body",
-		"Annotation",
-		"FileName",
-		"IsSelected",
-	}
+	return append(sink.Columns{}.Header(), "IsSelected")
 }
 
 func processLine(id int, tasks <-chan Task, results chan<- Result, wg *sync.WaitGroup) {
@@ -124,6 +93,12 @@ func processLine(id int, tasks <-chan Task, results chan<- Result, wg *sync.Wait
 			continue
 		}
 
+		unknownGenres.Add(book.Genres)
+		book.Genres = genre.Default().NormalizeAll(book.Genres)
+		if genreClassesPath != "" || book.GenreClass == "" {
+			book.GenreClass = classifier.Classify(book.Genres)
+		}
+
 		book.IsSelected = "0"
 		if task.Positives[book.FileName] {
 			log.Printf("Positive: %s", book.FileName)
@@ -151,8 +126,18 @@ func main() {
 	flag.StringVar(&negativesSamples, "negative_samples", "", "Negatives sample file path")
 	flag.StringVar(&matchedPositivesOutput, "matched_positives_output", "", "Where to store matched positives")
 	flag.BoolVar(&useFiles, "use_files", true, "Use files for custom labelling")
+	flag.StringVar(&genreClassesPath, "genre_classes", "", "JSON file with the genre classes, instead of the ones in the records")
 	flag.Parse()
 
+	classes := genre.DefaultClasses()
+	if genreClassesPath != "" {
+		var err error
+		if classes, err = genre.LoadClasses(genreClassesPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	classifier = genre.NewClassifier(classes)
+
 	if len(positiveSamples) < 1 {
 		log.Fatal("Positive samples file is required")
 	}
@@ -246,6 +231,7 @@ func main() {
 	}
 
 	log.Printf("Matched positives: %d", len(matchedPositives))
+	unknownGenres.Print(log.Writer())
 	if matchedPositivesOutput != "" {
 		matchedPositivesFile, err := os.Create(matchedPositivesOutput)
 		if err != nil {
@@ -0,0 +1,212 @@
+// Package langid identifies the language of a text with character n-gram
+// models. The built-in models cover Russian, Ukrainian, Belarusian,
+// Bulgarian and English and are trained on the texts in corpus/.
+package langid
+
+import (
+	"embed"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// maxOrder is the longest n-gram used.
+const maxOrder = 3
+
+// MaxSampleRunes bounds the part of a text looked at by Identify.
+const MaxSampleRunes = 4000
+
+// effectiveGrams is the number of independent n-grams a sample is counted
+// as when turning scores into a confidence. Neighbouring n-grams are far
+// from independent, counting them all would make every answer certain.
+const effectiveGrams = 50
+
+//go:embed corpus/*.txt
+var corpus embed.FS
+
+var (
+	defaultOnce       sync.Once
+	defaultIdentifier *Identifier
+)
+
+// Default returns the identifier built from the bundled corpus.
+func Default() *Identifier {
+	defaultOnce.Do(func() {
+		entries, err := corpus.ReadDir("corpus")
+		if err != nil {
+			panic(err)
+		}
+		samples := make(map[string]string)
+		for _, e := range entries {
+			data, err := corpus.ReadFile(path.Join("corpus", e.Name()))
+			if err != nil {
+				panic(err)
+			}
+			samples[strings.TrimSuffix(e.Name(), ".txt")] = string(data)
+		}
+		defaultIdentifier = New(samples)
+	})
+	return defaultIdentifier
+}
+
+// Result is the outcome of identifying a text.
+type Result struct {
+	// Lang is the ISO 639-1 code of the most likely language, or empty if
+	// the text has no letters.
+	Lang string
+	// Confidence is the probability of Lang, between 0 and 1.
+	Confidence float64
+}
+
+type model struct {
+	counts map[string]int
+	totals [maxOrder + 1]int
+}
+
+// Identifier holds a model per language.
+type Identifier struct {
+	langs  []string
+	models map[string]*model
+	// vocab is the number of distinct n-grams of each order over all
+	// languages, used for smoothing.
+	vocab [maxOrder + 1]int
+}
+
+// New builds an identifier from sample texts keyed by language code.
+func New(samples map[string]string) *Identifier {
+	id := &Identifier{models: make(map[string]*model)}
+	seen := make(map[string]bool)
+	for lang, text := range samples {
+		m := &model{counts: make(map[string]int)}
+		grams(text, len([]rune(text)), func(g string, order int) {
+			m.counts[g]++
+			m.totals[order]++
+			if !seen[g] {
+				seen[g] = true
+				id.vocab[order]++
+			}
+		})
+		id.langs = append(id.langs, lang)
+		id.models[lang] = m
+	}
+	sort.Strings(id.langs)
+	return id
+}
+
+// Languages returns the codes of the languages the identifier knows.
+func (id *Identifier) Languages() []string {
+	return id.langs
+}
+
+// Identify returns the most likely language of the first MaxSampleRunes of
+// text.
+func (id *Identifier) Identify(text string) Result {
+	scores := id.Scores(text)
+	best := Result{}
+	for lang, p := range scores {
+		if p > best.Confidence || p == best.Confidence && lang < best.Lang {
+			best = Result{Lang: lang, Confidence: p}
+		}
+	}
+	return best
+}
+
+// Scores returns the probability of each language for the first
+// MaxSampleRunes of text, or nil if the text has no letters.
+func (id *Identifier) Scores(text string) map[string]float64 {
+	logs := make(map[string]float64, len(id.langs))
+	n := 0
+	grams(text, MaxSampleRunes, func(g string, order int) {
+		n++
+		for _, lang := range id.langs {
+			m := id.models[lang]
+			logs[lang] += math.Log(float64(m.counts[g]+1) / float64(m.totals[order]+id.vocab[order]+1))
+		}
+	})
+	if n == 0 {
+		return nil
+	}
+
+	max := math.Inf(-1)
+	for _, l := range logs {
+		max = math.Max(max, l)
+	}
+	scale := float64(effectiveGrams) / float64(n)
+	// Summed in a fixed order, so that the scores of a text are the same
+	// on every run.
+	sum := 0.0
+	scores := make(map[string]float64, len(logs))
+	for _, lang := range id.langs {
+		scores[lang] = math.Exp((logs[lang] - max) * scale)
+		sum += scores[lang]
+	}
+	for lang := range scores {
+		scores[lang] /= sum
+	}
+	return scores
+}
+
+// grams calls fn with the n-grams of the words in the first limit runes of
+// text. Words are lower-cased runs of letters, padded with a space on both
+// sides.
+func grams(text string, limit int, fn func(g string, order int)) {
+	word := make([]rune, 0, 32)
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		padded := append(append([]rune{' '}, word...), ' ')
+		for order := 1; order <= maxOrder; order++ {
+			for i := 0; i+order <= len(padded); i++ {
+				if order == 1 && padded[i] == ' ' {
+					continue
+				}
+				fn(string(padded[i:i+order]), order)
+			}
+		}
+		word = word[:0]
+	}
+
+	for _, r := range text {
+		if limit == 0 {
+			break
+		}
+		limit--
+		switch {
+		case unicode.IsLetter(r):
+			word = append(word, unicode.ToLower(r))
+		case r == '\'' || r == '’' || r == 'ʼ':
+			if len(word) > 0 {
+				word = append(word, '\'')
+			}
+		default:
+			flush()
+		}
+	}
+	flush()
+}
+
+var tagAliases = map[string]string{
+	"rus": "ru", "russian": "ru", "русский": "ru",
+	"ukr": "uk", "ukrainian": "uk", "ua": "uk", "українська": "uk", "украинский": "uk",
+	"bel": "be", "belarusian": "be", "by": "be", "беларуская": "be", "белорусский": "be",
+	"bul": "bg", "bulgarian": "bg", "български": "bg", "болгарский": "bg",
+	"eng": "en", "english": "en", "английский": "en",
+}
+
+// NormalizeTag maps a language tag as found in <lang>, such as RU, ru-RU,
+// rus or russian, to its lower-case ISO 639-1 code. Unknown tags are only
+// lower-cased and stripped of the region.
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i > 0 {
+		tag = tag[:i]
+	}
+	if code, ok := tagAliases[tag]; ok {
+		return code
+	}
+	return tag
+}
@@ -0,0 +1,50 @@
+package langid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentify(t *testing.T) {
+	tests := []struct {
+		lang string
+		text string
+	}{
+		{"ru", "Вечером они собрались у костра и долго обсуждали, куда идти дальше. Никто не хотел возвращаться в город."},
+		{"uk", "Увечері вони зібралися біля багаття і довго обговорювали, куди йти далі. Ніхто не хотів повертатися до міста."},
+		{"be", "Увечары яны сабраліся каля вогнішча і доўга абмяркоўвалі, куды ісці далей. Ніхто не хацеў вяртацца ў горад."},
+		{"bg", "Вечерта те се събраха около огъня и дълго обсъждаха накъде да вървят. Никой не искаше да се връща в града."},
+		{"en", "In the evening they gathered around the fire and talked for a long time about where to go next. Nobody wanted to go back to the city."},
+	}
+
+	id := Default()
+	assert.Equal(t, []string{"be", "bg", "en", "ru", "uk"}, id.Languages())
+	for _, tt := range tests {
+		result := id.Identify(tt.text)
+		assert.Equal(t, tt.lang, result.Lang, tt.text)
+		assert.Greater(t, result.Confidence, 0.9, tt.text)
+	}
+}
+
+func TestIdentifyEmpty(t *testing.T) {
+	assert.Equal(t, Result{}, Default().Identify(""))
+	assert.Equal(t, Result{}, Default().Identify("123 — 456!"))
+	assert.Nil(t, Default().Scores(" "))
+}
+
+func TestNormalizeTag(t *testing.T) {
+	for tag, want := range map[string]string{
+		"ru":      "ru",
+		"RU":      "ru",
+		" ru-RU":  "ru",
+		"rus":     "ru",
+		"Russian": "ru",
+		"ua":      "uk",
+		"be_BY":   "be",
+		"de":      "de",
+		"":        "",
+	} {
+		assert.Equal(t, want, NormalizeTag(tag), tag)
+	}
+}
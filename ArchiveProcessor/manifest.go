@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ManifestEntry describes a processed archive.
+type ManifestEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	SHA256  string    `json:"sha256"`
+	// Config is the fingerprint of the settings the archive was processed
+	// with, see configFingerprint.
+	Config string `json:"config"`
+	// Shard is the output file the records of the archive went to.
+	Shard     string    `json:"shard"`
+	Processed time.Time `json:"processed"`
+}
+
+// Manifest records the archives processed by earlier runs, so that a run
+// over a growing set of archives only does the new work. Archives are keyed
+// by file name, so they can be moved between directories.
+type Manifest struct {
+	Archives map[string]ManifestEntry `json:"archives"`
+	// PendingShard is the output of a run that has not finished, reused by
+	// -resume.
+	PendingShard string `json:"pending_shard,omitempty"`
+
+	path string
+}
+
+// LoadManifest reads the manifest at path, or returns an empty one if there
+// is none yet.
+func LoadManifest(path string) (*Manifest, error) {
+	m := &Manifest{Archives: make(map[string]ManifestEntry), path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.Archives == nil {
+		m.Archives = make(map[string]ManifestEntry)
+	}
+	return m, nil
+}
+
+// Save writes the manifest through a temporary file, so that a crash leaves
+// either the old or the new version.
+func (m *Manifest) Save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// Changed reports whether an archive is new, differs from the one recorded
+// or was processed with another config. The hash is only computed when the
+// size or modification time differ.
+func (m *Manifest) Changed(archive, config string) (bool, error) {
+	entry, ok := m.Archives[filepath.Base(archive)]
+	if !ok || entry.Config != config {
+		return true, nil
+	}
+	info, err := os.Stat(archive)
+	if err != nil {
+		return false, err
+	}
+	if info.Size() != entry.Size {
+		return true, nil
+	}
+	if info.ModTime().Equal(entry.ModTime) {
+		return false, nil
+	}
+
+	// Touched but maybe not modified, as after a copy.
+	hash, err := fileSHA256(archive)
+	if err != nil {
+		return false, err
+	}
+	if hash != entry.SHA256 {
+		return true, nil
+	}
+	entry.ModTime = info.ModTime()
+	m.Archives[filepath.Base(archive)] = entry
+	return false, nil
+}
+
+// Record adds a processed archive to the manifest.
+func (m *Manifest) Record(archive, config, shard string) error {
+	info, err := os.Stat(archive)
+	if err != nil {
+		return err
+	}
+	hash, err := fileSHA256(archive)
+	if err != nil {
+		return err
+	}
+	m.Archives[filepath.Base(archive)] = ManifestEntry{
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		SHA256:    hash,
+		Config:    config,
+		Shard:     shard,
+		Processed: time.Now(),
+	}
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// configFingerprint hashes the settings that change the records of an
+// archive.
+func configFingerprint(settings interface{}) (string, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// shardPath names the output of a run started at t after output, such as
+// books.20240102-150405.jsonl for books.jsonl. A number is added if there is
+// a shard of that name already.
+func shardPath(output string, t time.Time) string {
+	ext := filepath.Ext(output)
+	base := strings.TrimSuffix(output, ext) + "." + t.Format("20060102-150405")
+	path := base + ext
+	for n := 2; ; n++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "fb2-000001-000100.zip")
+	assert.NoError(t, os.WriteFile(archive, []byte("zip"), 0644))
+	path := filepath.Join(dir, "manifest.json")
+
+	m, err := LoadManifest(path)
+	assert.NoError(t, err)
+	changed, err := m.Changed(archive, "c1")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	assert.NoError(t, m.Record(archive, "c1", "books.1.jsonl"))
+	assert.NoError(t, m.Save())
+
+	m, err = LoadManifest(path)
+	assert.NoError(t, err)
+	entry := m.Archives["fb2-000001-000100.zip"]
+	assert.Equal(t, int64(3), entry.Size)
+	assert.Equal(t, "books.1.jsonl", entry.Shard)
+	assert.Len(t, entry.SHA256, 64)
+
+	changed, err = m.Changed(archive, "c1")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// Another config.
+	changed, err = m.Changed(archive, "c2")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	// Touched, same content.
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(archive, later, later))
+	changed, err = m.Changed(archive, "c1")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.True(t, m.Archives["fb2-000001-000100.zip"].ModTime.Equal(later))
+
+	// Same size, new content.
+	assert.NoError(t, os.WriteFile(archive, []byte("ZIP"), 0644))
+	changed, err = m.Changed(archive, "c1")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+}
+
+func TestConfigFingerprint(t *testing.T) {
+	a, err := configFingerprint(map[string]int{"truncate_to": 10000})
+	assert.NoError(t, err)
+	b, err := configFingerprint(map[string]int{"truncate_to": 5000})
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, b)
+	assert.Len(t, a, 16)
+}
+
+func TestShardPath(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	output := filepath.Join(dir, "books.jsonl")
+	path := shardPath(output, now)
+	assert.Equal(t, filepath.Join(dir, "books.20240102-150405.jsonl"), path)
+
+	assert.NoError(t, os.WriteFile(path, nil, 0644))
+	assert.Equal(t, filepath.Join(dir, "books.20240102-150405-2.jsonl"), shardPath(output, now))
+}
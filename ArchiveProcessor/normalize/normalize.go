@@ -0,0 +1,172 @@
+// Package normalize cleans up the text of books: invisible characters,
+// Unicode forms, whitespace, quotes and dashes, and optionally ё. Lines are
+// kept, as the text of a book has a paragraph per line.
+package normalize
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Step is a normalization step.
+type Step string
+
+// The steps, in the order they are applied.
+const (
+	// Controls drops control and format characters other than tabs and
+	// line breaks, such as soft hyphens, zero-width spaces and byte order
+	// marks.
+	Controls Step = "controls"
+	// NFC composes characters, so that "е" followed by a combining
+	// diaeresis becomes "ё".
+	NFC Step = "nfc"
+	// Whitespace turns all spaces, such as non-breaking ones, into plain
+	// spaces, collapses runs of them, trims lines and drops empty ones.
+	Whitespace Step = "whitespace"
+	// Quotes turns double quotes into « and », whether they open or close
+	// is told from the characters around them, and single quotes and
+	// apostrophes into '.
+	Quotes Step = "quotes"
+	// Dashes turns a hyphen, double hyphen or other dash standing between
+	// spaces, or starting a line of dialogue, into an em dash. Hyphens and
+	// dashes within words, as in "кто-то" or "1941–1945", are kept.
+	Dashes Step = "dashes"
+	// Yo replaces ё with е.
+	Yo Step = "yo"
+)
+
+// Steps is a list of steps. They are always applied in the order of All.
+type Steps []Step
+
+// All lists the steps in the order they are applied.
+var All = Steps{Controls, NFC, Whitespace, Quotes, Dashes, Yo}
+
+// Default is every step but Yo.
+var Default = Steps{Controls, NFC, Whitespace, Quotes, Dashes}
+
+// ParseSteps parses a comma separated list of steps, or "none".
+func ParseSteps(list string) (Steps, error) {
+	steps := Steps{}
+	if list == "none" {
+		return steps, nil
+	}
+	seen := make(map[Step]bool)
+	for _, name := range strings.Split(list, ",") {
+		step := Step(strings.TrimSpace(name))
+		if !slices.Contains(All, step) {
+			return nil, fmt.Errorf("unknown normalization step %q, want some of %s or none", name, All)
+		}
+		seen[step] = true
+	}
+	for _, step := range All {
+		if seen[step] {
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+func (s Steps) String() string {
+	names := make([]string, len(s))
+	for i, step := range s {
+		names[i] = string(step)
+	}
+	return strings.Join(names, ",")
+}
+
+// Apply returns the normalized text.
+func (s Steps) Apply(text string) string {
+	if slices.Contains(s, Controls) {
+		text = strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\n' || !unicode.In(r, unicode.Cc, unicode.Cf) {
+				return r
+			}
+			return -1
+		}, text)
+	}
+	if slices.Contains(s, NFC) {
+		text = norm.NFC.String(text)
+	}
+	if slices.Contains(s, Whitespace) {
+		text = collapseWhitespace(text)
+	}
+	if slices.Contains(s, Quotes) {
+		text = unifyQuotes(text)
+	}
+	if slices.Contains(s, Dashes) {
+		text = unifyDashes(text)
+	}
+	if slices.Contains(s, Yo) {
+		text = strings.NewReplacer("ё", "е", "Ё", "Е").Replace(text)
+	}
+	return text
+}
+
+func collapseWhitespace(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.Join(strings.FieldsFunc(line, unicode.IsSpace), " "); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+func unifyQuotes(text string) string {
+	runes := []rune(text)
+	for i, r := range runes {
+		switch r {
+		case '"', '“', '”', '„', '‟':
+			if opensQuote(runes, i) {
+				runes[i] = '«'
+			} else {
+				runes[i] = '»'
+			}
+		case '‘', '’', '‚', '‛':
+			runes[i] = '\''
+		}
+	}
+	return string(runes)
+}
+
+// opensQuote reports whether the quote at i opens: it starts a line or
+// follows a space, a bracket, a dash or another opening quote, and is
+// followed by something other than a space.
+func opensQuote(runes []rune, i int) bool {
+	if i+1 == len(runes) || unicode.IsSpace(runes[i+1]) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	prev := runes[i-1]
+	return unicode.IsSpace(prev) || strings.ContainsRune("([{«—–-", prev)
+}
+
+func unifyDashes(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		words := strings.Split(line, " ")
+		for j, word := range words {
+			if len(words) > 1 && isDash(word) {
+				words[j] = "—"
+			}
+		}
+		lines[i] = strings.Join(words, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isDash reports whether a word standing on its own is a dash.
+func isDash(word string) bool {
+	switch word {
+	case "-", "--", "---", "–", "—", "―", "‒", "−":
+		return true
+	}
+	return false
+}
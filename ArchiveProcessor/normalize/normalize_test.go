@@ -0,0 +1,50 @@
+package normalize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		steps Steps
+		text  string
+		want  string
+	}{
+		{Steps{Controls}, "Пере\u00adнос\u200b и\ufeff\tтаб\r\nстрока", "Перенос и\tтаб\nстрока"},
+		{Steps{NFC}, "Е\u0308лка", "Ёлка"},
+		{Steps{Whitespace}, "  погода.  Эти \n\n\t острова  \n", "погода. Эти\nострова"},
+		{Steps{Quotes}, `"Да", сказал он. „Нет“ и “может” — д’Артаньян`, "«Да», сказал он. «Нет» и «может» — д'Артаньян"},
+		{Steps{Quotes}, `("Пикник")"`, "(«Пикник»)»"},
+		{Steps{Dashes}, "- Привет, -- сказал он. – Кто-то был в 1941–1945 гг.\n-", "— Привет, — сказал он. — Кто-то был в 1941–1945 гг.\n-"},
+		{Steps{Yo}, "Ёжик ещё", "Ежик еще"},
+		{Default, "\ufeff- \"Е\u0308лка\u00a0- ёж\"", "— «Ёлка — ёж»"},
+		{Steps{}, " as is ", " as is "},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.steps.Apply(tt.text), tt.text)
+	}
+}
+
+func TestApplyOrder(t *testing.T) {
+	// ё is composed before it is replaced, whatever the order given.
+	steps, err := ParseSteps("yo,nfc")
+	assert.NoError(t, err)
+	assert.Equal(t, Steps{NFC, Yo}, steps)
+	assert.Equal(t, "елка", steps.Apply("ёлка"))
+}
+
+func TestParseSteps(t *testing.T) {
+	steps, err := ParseSteps("dashes, controls")
+	assert.NoError(t, err)
+	assert.Equal(t, Steps{Controls, Dashes}, steps)
+	assert.Equal(t, "controls,dashes", steps.String())
+
+	steps, err = ParseSteps("none")
+	assert.NoError(t, err)
+	assert.Empty(t, steps)
+
+	_, err = ParseSteps("nfc,nfkc")
+	assert.Error(t, err)
+}
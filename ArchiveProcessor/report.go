@@ -0,0 +1,211 @@
+package main
+
+import (
+	"ArchiveProcessor/filter"
+	"ArchiveProcessor/normalize"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reason says why a book did not make it into the output.
+type Reason string
+
+const (
+	// Failures: the book could not be read. Write errors abort the run.
+	ReasonOpen  Reason = "open"
+	ReasonParse Reason = "parse"
+
+	// Rejections by the structural checks of ExtractBook. Rejections by a
+	// filter have the reason filter:<name>, see filterReason.
+	ReasonNoGenres  Reason = "no-genres"
+	ReasonNoTitle   Reason = "no-title"
+	ReasonNoBody    Reason = "no-body"
+	ReasonNoAuthors Reason = "no-authors"
+
+	// ReasonOther is reported for errors without a reason.
+	ReasonOther Reason = "other"
+)
+
+func filterReason(name string) Reason {
+	return Reason("filter:" + name)
+}
+
+// IsFailure reports whether the reason is an error rather than a rejection.
+func (r Reason) IsFailure() bool {
+	return r == ReasonOpen || r == ReasonParse || r == ReasonOther
+}
+
+// Rejection is an error with the reason a book was dropped.
+type Rejection struct {
+	Reason Reason
+	Err    error
+}
+
+func (r *Rejection) Error() string { return r.Err.Error() }
+
+func (r *Rejection) Unwrap() error { return r.Err }
+
+func reject(reason Reason, format string, args ...interface{}) error {
+	return &Rejection{Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+// ReasonOf returns the reason of an error returned by ExtractBook.
+func ReasonOf(err error) Reason {
+	var r *Rejection
+	if errors.As(err, &r) {
+		return r.Reason
+	}
+	var fr *filter.Rejection
+	if errors.As(err, &fr) {
+		return filterReason(fr.Filter)
+	}
+	return ReasonOther
+}
+
+// ExtractionStats counts the books of one archive or of a whole run.
+type ExtractionStats struct {
+	Total    int `json:"total"`
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+	// Failed counts books that could not be opened or parsed.
+	Failed int `json:"failed"`
+	// Skipped counts books left out on resume because an earlier run
+	// handled them. They are not part of Total.
+	Skipped  int            `json:"skipped,omitempty"`
+	ByReason map[Reason]int `json:"by_reason"`
+	// Encodings counts the encodings of the parsed books.
+	Encodings map[string]int `json:"encodings"`
+}
+
+func newExtractionStats() *ExtractionStats {
+	return &ExtractionStats{
+		ByReason:  make(map[Reason]int),
+		Encodings: make(map[string]int),
+	}
+}
+
+// add counts a book with the error it was dropped with, or nil if it was
+// accepted. The encoding is empty for books that were not parsed.
+func (s *ExtractionStats) add(encoding string, err error) {
+	s.Total++
+	if encoding != "" {
+		s.Encodings[encoding]++
+	}
+	if err == nil {
+		s.Accepted++
+		return
+	}
+
+	reason := ReasonOf(err)
+	s.ByReason[reason]++
+	if reason.IsFailure() {
+		s.Failed++
+	} else {
+		s.Rejected++
+	}
+}
+
+func (s *ExtractionStats) merge(other *ExtractionStats) {
+	s.Total += other.Total
+	s.Accepted += other.Accepted
+	s.Rejected += other.Rejected
+	s.Failed += other.Failed
+	s.Skipped += other.Skipped
+	for r, n := range other.ByReason {
+		s.ByReason[r] += n
+	}
+	for e, n := range other.Encodings {
+		s.Encodings[e] += n
+	}
+}
+
+// Print writes the counts to w.
+func (s *ExtractionStats) Print(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s: %d books, %d accepted, %d rejected, %d failed\n",
+		name, s.Total, s.Accepted, s.Rejected, s.Failed)
+	if s.Skipped > 0 {
+		fmt.Fprintf(w, "  %-20s %d\n", "skipped on resume", s.Skipped)
+	}
+	for _, r := range sortedKeys(s.ByReason) {
+		fmt.Fprintf(w, "  %-20s %d\n", r, s.ByReason[r])
+	}
+
+	encodings := make([]string, 0, len(s.Encodings))
+	for _, e := range sortedKeys(s.Encodings) {
+		encodings = append(encodings, fmt.Sprintf("%s %d", e, s.Encodings[e]))
+	}
+	if len(encodings) > 0 {
+		fmt.Fprintf(w, "  encodings: %s\n", strings.Join(encodings, ", "))
+	}
+}
+
+func sortedKeys[K ~string](m map[K]int) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// ArchiveReport is the stats of one archive.
+type ArchiveReport struct {
+	Archive string `json:"archive"`
+	// Error is why the archive could not be opened, its books are not
+	// counted then.
+	Error string `json:"error,omitempty"`
+	*ExtractionStats
+}
+
+// RunReport is the JSON summary of a run.
+type RunReport struct {
+	Started  time.Time        `json:"started"`
+	Finished time.Time        `json:"finished"`
+	Archives []ArchiveReport  `json:"archives"`
+	Total    *ExtractionStats `json:"total"`
+	// FailedArchives counts the archives that could not be opened.
+	FailedArchives int `json:"failed_archives"`
+	// Normalization is the normalization steps applied to the text.
+	Normalization normalize.Steps `json:"normalization"`
+
+	mu sync.Mutex
+}
+
+func newRunReport() *RunReport {
+	return &RunReport{Started: time.Now(), Total: newExtractionStats()}
+}
+
+// addArchive records the stats of an archive.
+func (r *RunReport) addArchive(archive string, stats *ExtractionStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Archives = append(r.Archives, ArchiveReport{Archive: archive, ExtractionStats: stats})
+	r.Total.merge(stats)
+}
+
+// failArchive records an archive that could not be opened.
+func (r *RunReport) failArchive(archive string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Archives = append(r.Archives, ArchiveReport{Archive: archive, Error: err.Error(), ExtractionStats: newExtractionStats()})
+	r.FailedArchives++
+}
+
+// Save sets the finish time and writes the report to path.
+func (r *RunReport) Save(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Finished = time.Now()
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"ArchiveProcessor/filter"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReasonOf(t *testing.T) {
+	assert.Equal(t, ReasonNoTitle, ReasonOf(reject(ReasonNoTitle, "error finding book title")))
+	assert.Equal(t, ReasonParse, ReasonOf(fmt.Errorf("wrapped: %w", reject(ReasonParse, "bad"))))
+	assert.Equal(t, Reason("filter:lang"), ReasonOf(&filter.Rejection{Filter: "lang", Err: errors.New("en")}))
+	assert.Equal(t, ReasonOther, ReasonOf(errors.New("unknown")))
+	assert.EqualError(t, reject(ReasonNoBody, "error finding body"), "error finding body")
+}
+
+func TestExtractionStats(t *testing.T) {
+	a := newExtractionStats()
+	a.add("utf-8", nil)
+	a.add("windows-1251", reject(ReasonNoAuthors, "no authors found"))
+	a.add("", reject(ReasonParse, "bad"))
+	b := newExtractionStats()
+	b.add("utf-8", &filter.Rejection{Filter: "sample", Err: errors.New("not sampled")})
+
+	r := newRunReport()
+	r.addArchive("a.zip", a)
+	r.addArchive("b.zip", b)
+	assert.Equal(t, 4, r.Total.Total)
+	assert.Equal(t, 1, r.Total.Accepted)
+	assert.Equal(t, 2, r.Total.Rejected)
+	assert.Equal(t, 1, r.Total.Failed)
+	assert.Equal(t, map[Reason]int{ReasonNoAuthors: 1, ReasonParse: 1, "filter:sample": 1}, r.Total.ByReason)
+	assert.Equal(t, map[string]int{"utf-8": 2, "windows-1251": 1}, r.Total.Encodings)
+
+	var buf bytes.Buffer
+	r.Total.Print(&buf, "total")
+	assert.Equal(t, "total: 4 books, 1 accepted, 2 rejected, 1 failed\n"+
+		"  filter:sample        1\n  no-authors           1\n  parse                1\n"+
+		"  encodings: utf-8 2, windows-1251 1\n", buf.String())
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	assert.NoError(t, r.Save(path))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var saved struct {
+		Archives []struct {
+			Archive  string `json:"archive"`
+			Accepted int    `json:"accepted"`
+		} `json:"archives"`
+		Total struct {
+			ByReason map[string]int `json:"by_reason"`
+		} `json:"total"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &saved))
+	assert.Equal(t, "a.zip", saved.Archives[0].Archive)
+	assert.Equal(t, 1, saved.Archives[0].Accepted)
+	assert.Equal(t, 1, saved.Total.ByReason["parse"])
+}
+
+func TestFailArchive(t *testing.T) {
+	r := newRunReport()
+	r.failArchive("bad.zip", errors.New("zip: not a valid zip file"))
+	r.addArchive("good.zip", newExtractionStats())
+	assert.Equal(t, 1, r.FailedArchives)
+	assert.Equal(t, "zip: not a valid zip file", r.Archives[0].Error)
+	assert.Empty(t, r.Archives[1].Error)
+
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"failed_archives":1`)
+	assert.Contains(t, string(data), `{"archive":"bad.zip","error":"zip: not a valid zip file","total":0`)
+}
@@ -0,0 +1,162 @@
+package schema
+
+import (
+	"sort"
+)
+
+// nfa is a content model compiled into a nondeterministic automaton over
+// child element names.
+type nfa struct {
+	states []nfaState
+	start  int
+	accept int
+}
+
+type nfaState struct {
+	epsilon []int
+	edges   []nfaEdge
+}
+
+type nfaEdge struct {
+	elem *elementDecl
+	to   int
+}
+
+// compile builds the automaton for a content model. A nil particle is the
+// empty content model.
+func compile(p *particle) *nfa {
+	a := &nfa{}
+	a.start = a.newState()
+	a.accept = a.start
+	if p != nil {
+		a.accept = a.build(p, a.start)
+	}
+	return a
+}
+
+func (a *nfa) newState() int {
+	a.states = append(a.states, nfaState{})
+	return len(a.states) - 1
+}
+
+func (a *nfa) link(from, to int) {
+	a.states[from].epsilon = append(a.states[from].epsilon, to)
+}
+
+// build adds the states for p starting at from and returns the final state.
+func (a *nfa) build(p *particle, from int) int {
+	for i := 0; i < p.min; i++ {
+		from = a.buildOnce(p, from)
+	}
+
+	if p.max == unbounded {
+		loop := a.newState()
+		a.link(from, loop)
+		end := a.buildOnce(p, loop)
+		a.link(end, loop)
+		return loop
+	}
+
+	for i := p.min; i < p.max; i++ {
+		end := a.buildOnce(p, from)
+		skip := a.newState()
+		a.link(from, skip)
+		a.link(end, skip)
+		from = skip
+	}
+	return from
+}
+
+func (a *nfa) buildOnce(p *particle, from int) int {
+	switch p.kind {
+	case particleElement:
+		to := a.newState()
+		a.states[from].edges = append(a.states[from].edges, nfaEdge{elem: p.elem, to: to})
+		return to
+	case particleSequence:
+		for _, c := range p.children {
+			from = a.build(c, from)
+		}
+		return from
+	default:
+		end := a.newState()
+		for _, c := range p.children {
+			a.link(a.build(c, from), end)
+		}
+		if len(p.children) == 0 {
+			a.link(from, end)
+		}
+		return end
+	}
+}
+
+// stateSet is a set of automaton states closed under epsilon moves.
+type stateSet []int
+
+func (a *nfa) closure(states []int) stateSet {
+	seen := make(map[int]bool, len(states))
+	stack := append([]int{}, states...)
+	var set stateSet
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		set = append(set, s)
+		stack = append(stack, a.states[s].epsilon...)
+	}
+	sort.Ints(set)
+	return set
+}
+
+func (a *nfa) initial() stateSet {
+	return a.closure([]int{a.start})
+}
+
+// step moves the set over a child element. It returns the declaration of the
+// child, or nil and an empty set if the element is not allowed here.
+func (a *nfa) step(set stateSet, name string) (stateSet, *elementDecl) {
+	var next []int
+	var decl *elementDecl
+	for _, s := range set {
+		for _, e := range a.states[s].edges {
+			if e.elem.name == name {
+				next = append(next, e.to)
+				if decl == nil {
+					decl = e.elem
+				}
+			}
+		}
+	}
+	if len(next) == 0 {
+		return nil, nil
+	}
+	return a.closure(next), decl
+}
+
+func (a *nfa) accepts(set stateSet) bool {
+	for _, s := range set {
+		if s == a.accept {
+			return true
+		}
+	}
+	return false
+}
+
+// expected returns the sorted names of the elements allowed next.
+func (a *nfa) expected(set stateSet) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, s := range set {
+		for _, e := range a.states[s].edges {
+			if !seen[e.elem.name] {
+				seen[e.elem.name] = true
+				names = append(names, e.elem.name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
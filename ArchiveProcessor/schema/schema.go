@@ -0,0 +1,402 @@
+// Package schema validates FB2 documents against the subset of XML Schema
+// used by fictionbook2.xsd: sequences, choices, occurrence bounds, simple and
+// complex content, type extension, attribute declarations and enumerations.
+package schema
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const xsdNamespace = "http://www.w3.org/2001/XMLSchema"
+
+//go:embed fictionbook2.xsd
+var fictionBookXSD []byte
+
+var (
+	fictionBookOnce   sync.Once
+	fictionBookSchema *Schema
+)
+
+// FictionBook returns the schema compiled from the bundled fictionbook2.xsd.
+func FictionBook() *Schema {
+	fictionBookOnce.Do(func() {
+		s, err := Parse(bytes.NewReader(fictionBookXSD))
+		if err != nil {
+			panic(fmt.Sprintf("bundled fictionbook2.xsd: %+v", err))
+		}
+		fictionBookSchema = s
+	})
+	return fictionBookSchema
+}
+
+// Schema is a compiled XML schema.
+type Schema struct {
+	Namespace string
+	elements  map[string]*elementDecl
+
+	complexTypes map[string]*node
+	simpleTypes  map[string]*node
+	types        map[string]*typeDef
+	prefixes     map[string]string
+}
+
+type elementDecl struct {
+	name string
+	typ  *typeDef
+}
+
+// typeDef is a compiled type. A nil *typeDef accepts any content.
+type typeDef struct {
+	name string
+
+	// simple is set for types with text-only content and names the
+	// built-in or enumerated type of the text.
+	simple *simpleType
+	mixed  bool
+	model  *nfa
+	attrs  []attrDecl
+}
+
+type attrDecl struct {
+	name     xml.Name
+	typ      *simpleType
+	required bool
+}
+
+type simpleType struct {
+	name        string
+	enumeration []string
+}
+
+// node is an element of the schema document.
+type node struct {
+	name     xml.Name
+	attrs    map[string]string
+	children []*node
+}
+
+func (n *node) attr(name string) string {
+	return n.attrs[name]
+}
+
+func parseNode(d *xml.Decoder, start xml.StartElement) (*node, error) {
+	n := &node{name: start.Name, attrs: make(map[string]string)}
+	for _, a := range start.Attr {
+		if a.Name.Space == "xmlns" {
+			continue
+		}
+		n.attrs[a.Name.Local] = a.Value
+	}
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := parseNode(d, t)
+			if err != nil {
+				return nil, err
+			}
+			if child.name.Space == xsdNamespace && child.name.Local != "annotation" {
+				n.children = append(n.children, child)
+			}
+		case xml.EndElement:
+			return n, nil
+		}
+	}
+}
+
+// Parse reads and compiles an XML schema.
+func Parse(r io.Reader) (*Schema, error) {
+	d := xml.NewDecoder(r)
+	var root *node
+	prefixes := map[string]string{"xml": xmlNamespace}
+	for root == nil {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			for _, a := range start.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					prefixes[a.Name.Local] = a.Value
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					prefixes[""] = a.Value
+				}
+			}
+			if root, err = parseNode(d, start); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if root.name.Space != xsdNamespace || root.name.Local != "schema" {
+		return nil, fmt.Errorf("not an XML schema: root element %s", root.name.Local)
+	}
+
+	s := &Schema{
+		Namespace:    root.attr("targetNamespace"),
+		elements:     make(map[string]*elementDecl),
+		complexTypes: make(map[string]*node),
+		simpleTypes:  make(map[string]*node),
+		types:        make(map[string]*typeDef),
+		prefixes:     prefixes,
+	}
+	for _, c := range root.children {
+		switch c.name.Local {
+		case "complexType":
+			s.complexTypes[c.attr("name")] = c
+		case "simpleType":
+			s.simpleTypes[c.attr("name")] = c
+		}
+	}
+	for _, c := range root.children {
+		if c.name.Local == "element" {
+			decl, err := s.element(c)
+			if err != nil {
+				return nil, err
+			}
+			s.elements[decl.name] = decl
+		}
+	}
+	return s, nil
+}
+
+// resolve splits a QName into its namespace and local name.
+func (s *Schema) resolve(qname string) xml.Name {
+	prefix, local, found := strings.Cut(qname, ":")
+	if !found {
+		return xml.Name{Space: s.prefixes[""], Local: qname}
+	}
+	return xml.Name{Space: s.prefixes[prefix], Local: local}
+}
+
+// simpleName names a simple type by its local name if it is built in, and by
+// its QName otherwise.
+func (s *Schema) simpleName(qname string) string {
+	name := s.resolve(qname)
+	if name.Space == xsdNamespace {
+		return name.Local
+	}
+	return qname
+}
+
+func (s *Schema) element(n *node) (*elementDecl, error) {
+	decl := &elementDecl{name: n.attr("name")}
+	if t := n.attr("type"); t != "" {
+		typ, err := s.namedType(t)
+		if err != nil {
+			return nil, fmt.Errorf("element %s: %w", decl.name, err)
+		}
+		decl.typ = typ
+		return decl, nil
+	}
+
+	for _, c := range n.children {
+		switch c.name.Local {
+		case "complexType":
+			typ := &typeDef{name: decl.name}
+			if err := s.compileComplex(typ, c); err != nil {
+				return nil, fmt.Errorf("element %s: %w", decl.name, err)
+			}
+			decl.typ = typ
+		case "simpleType":
+			decl.typ = &typeDef{name: decl.name, simple: s.compileSimple(c)}
+		}
+	}
+	// An element without a type accepts anything.
+	return decl, nil
+}
+
+// namedType returns the compiled type for a type QName.
+func (s *Schema) namedType(qname string) (*typeDef, error) {
+	name := s.resolve(qname)
+	if name.Space != s.Namespace {
+		simple := s.simpleName(qname)
+		return &typeDef{name: simple, simple: &simpleType{name: simple}}, nil
+	}
+	if typ, ok := s.types[name.Local]; ok {
+		return typ, nil
+	}
+
+	if n, ok := s.simpleTypes[name.Local]; ok {
+		typ := &typeDef{name: name.Local, simple: s.compileSimple(n)}
+		s.types[name.Local] = typ
+		return typ, nil
+	}
+
+	n, ok := s.complexTypes[name.Local]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %s", qname)
+	}
+	// Register before compiling, types may refer to themselves.
+	typ := &typeDef{name: name.Local}
+	s.types[name.Local] = typ
+	if err := s.compileComplex(typ, n); err != nil {
+		return nil, fmt.Errorf("type %s: %w", name.Local, err)
+	}
+	return typ, nil
+}
+
+func (s *Schema) compileSimple(n *node) *simpleType {
+	st := &simpleType{name: n.attr("name")}
+	for _, c := range n.children {
+		if c.name.Local != "restriction" {
+			continue
+		}
+		if st.name == "" {
+			st.name = s.simpleName(c.attr("base"))
+		}
+		for _, e := range c.children {
+			if e.name.Local == "enumeration" {
+				st.enumeration = append(st.enumeration, e.attr("value"))
+			}
+		}
+	}
+	return st
+}
+
+func (s *Schema) compileComplex(typ *typeDef, n *node) error {
+	typ.mixed = n.attr("mixed") == "true"
+	var content *particle
+	for _, c := range n.children {
+		switch c.name.Local {
+		case "sequence", "choice", "all":
+			p, err := s.particle(c)
+			if err != nil {
+				return err
+			}
+			content = p
+		case "attribute":
+			if err := s.addAttr(typ, c); err != nil {
+				return err
+			}
+		case "simpleContent", "complexContent":
+			for _, ext := range c.children {
+				if ext.name.Local != "extension" && ext.name.Local != "restriction" {
+					continue
+				}
+				base, err := s.namedType(ext.attr("base"))
+				if err != nil {
+					return err
+				}
+				if base.simple == nil && base.model == nil {
+					return fmt.Errorf("type %s extends itself", base.name)
+				}
+				typ.simple = base.simple
+				typ.mixed = typ.mixed || base.mixed || c.attr("mixed") == "true"
+				typ.model = base.model
+				typ.attrs = append(typ.attrs, base.attrs...)
+				for _, e := range ext.children {
+					switch e.name.Local {
+					case "attribute":
+						if err := s.addAttr(typ, e); err != nil {
+							return err
+						}
+					case "sequence", "choice", "all":
+						return fmt.Errorf("extending content models is not supported")
+					}
+				}
+			}
+		}
+	}
+	if typ.simple == nil && typ.model == nil {
+		typ.model = compile(content)
+	}
+	return nil
+}
+
+func (s *Schema) addAttr(typ *typeDef, n *node) error {
+	decl := attrDecl{required: n.attr("use") == "required"}
+	if ref := n.attr("ref"); ref != "" {
+		decl.name = s.resolve(ref)
+		decl.typ = &simpleType{name: s.simpleName(ref)}
+	} else {
+		decl.name = xml.Name{Local: n.attr("name")}
+		if t := n.attr("type"); t != "" {
+			at, err := s.namedType(t)
+			if err != nil {
+				return err
+			}
+			decl.typ = at.simple
+		}
+		for _, c := range n.children {
+			if c.name.Local == "simpleType" {
+				decl.typ = s.compileSimple(c)
+			}
+		}
+	}
+	typ.attrs = append(typ.attrs, decl)
+	return nil
+}
+
+// unbounded is the maxOccurs of unbounded particles.
+const unbounded = -1
+
+type particleKind int
+
+const (
+	particleElement particleKind = iota
+	particleSequence
+	particleChoice
+)
+
+type particle struct {
+	kind     particleKind
+	min, max int
+	elem     *elementDecl
+	children []*particle
+}
+
+func occurs(n *node, name string) (int, error) {
+	v := n.attr(name)
+	switch v {
+	case "":
+		return 1, nil
+	case "unbounded":
+		return unbounded, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func (s *Schema) particle(n *node) (*particle, error) {
+	p := &particle{}
+	var err error
+	if p.min, err = occurs(n, "minOccurs"); err != nil {
+		return nil, err
+	}
+	if p.max, err = occurs(n, "maxOccurs"); err != nil {
+		return nil, err
+	}
+
+	switch n.name.Local {
+	case "element":
+		p.kind = particleElement
+		p.elem, err = s.element(n)
+		return p, err
+	case "sequence", "all":
+		p.kind = particleSequence
+	case "choice":
+		p.kind = particleChoice
+	default:
+		return nil, fmt.Errorf("unsupported particle %s", n.name.Local)
+	}
+
+	for _, c := range n.children {
+		child, err := s.particle(c)
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, child)
+	}
+	return p, nil
+}
@@ -0,0 +1,134 @@
+package schema
+
+import (
+	"ArchiveProcessor/fb2"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const header = `<?xml version="1.0" encoding="utf-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0" xmlns:l="http://www.w3.org/1999/xlink">`
+
+const description = `<description>
+<title-info><genre>sf</genre><author><first-name>A</first-name><last-name>B</last-name></author>
+<book-title>T</book-title><lang>ru</lang></title-info>
+<document-info><author><nickname>n</nickname></author><date>2020</date><id>x</id><version>1.0</version></document-info>
+</description>`
+
+func validate(t *testing.T, doc string) []Violation {
+	violations, err := FictionBook().Validate(strings.NewReader(doc))
+	assert.NoError(t, err)
+	return violations
+}
+
+func kinds(violations []Violation) []Kind {
+	var result []Kind
+	for _, v := range violations {
+		result = append(result, v.Kind)
+	}
+	return result
+}
+
+func TestValidateTestdata(t *testing.T) {
+	for _, file := range []string{"177691.fb2", "177692.fb2", "177693.fb2", "184407.fb2"} {
+		f, err := os.Open("../fb2/testdata/" + file)
+		assert.NoError(t, err)
+		violations, err := FictionBook().Validate(f)
+		f.Close()
+		assert.NoError(t, err, file)
+		assert.Empty(t, violations, file)
+	}
+}
+
+func TestValidateNickName(t *testing.T) {
+	f, err := os.Open("../fb2/testbook.xml")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	violations, err := FictionBook().Validate(f)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(violations))
+	v := violations[0]
+	assert.Equal(t, UnexpectedElement, v.Kind)
+	assert.Equal(t, "/FictionBook/description[1]/title-info[1]/author[2]/nick-name[1]", v.Path)
+	assert.Equal(t, 18, v.Line)
+	assert.Equal(t, "unexpected element <nick-name> in <author>", v.Message)
+	assert.Contains(t, v.Expected, "nickname")
+}
+
+func TestValidateValid(t *testing.T) {
+	doc := header + description + `<body><section id="s1"><p>one <emphasis>two</emphasis></p>
+<table><tr align="center"><td colspan="2">x</td></tr></table></section></body>
+<binary id="b1" content-type="image/png">iVBORw0K
+GgoAAAA=</binary></FictionBook>`
+	assert.Empty(t, validate(t, doc))
+}
+
+func TestValidateViolations(t *testing.T) {
+	doc := header + description + `<body><section id="s1"><p>one</p><title><p>late</p></title>
+text</section><section id="s1"><p bogus="1">two</p></section>
+<section><table><tr align="middle"><td colspan="two">x</td></tr></table></section></body>
+<binary content-type="image/png">not base64!</binary></FictionBook>`
+
+	violations := validate(t, doc)
+	assert.Equal(t, []Kind{
+		UnexpectedElement,
+		UnexpectedText,
+		DuplicateID,
+		UnknownAttribute,
+		InvalidValue,
+		InvalidValue,
+		MissingAttribute,
+		InvalidValue,
+	}, kinds(violations))
+
+	assert.Equal(t, "/FictionBook/body[1]/section[1]/title[1]", violations[0].Path)
+	assert.Equal(t, 6, violations[0].Line)
+	assert.Equal(t, "/FictionBook/body[1]/section[2]", violations[2].Path)
+	assert.Equal(t, "s1", violations[2].Value)
+	assert.Equal(t, "/FictionBook/body[1]/section[3]/table[1]/tr[1]", violations[4].Path)
+	assert.Equal(t, []string{"left", "right", "center"}, violations[4].Expected)
+	assert.Equal(t, "invalid integer value of attribute colspan", violations[5].Message)
+	assert.Equal(t, "missing attribute id on <binary>", violations[6].Message)
+}
+
+func TestValidateMissingElement(t *testing.T) {
+	violations := validate(t, header+`<description><title-info><genre>sf</genre></title-info>
+<document-info><author><nickname>n</nickname></author><date>2020</date><id>x</id><version>1.0</version></document-info>
+</description></FictionBook>`)
+
+	assert.Equal(t, []Kind{MissingElement, MissingElement}, kinds(violations))
+	assert.Equal(t, "/FictionBook/description[1]/title-info[1]", violations[0].Path)
+	assert.Equal(t, []string{"author", "genre"}, violations[0].Expected)
+	assert.Equal(t, "/FictionBook", violations[1].Path)
+	assert.Equal(t, []string{"body"}, violations[1].Expected)
+}
+
+func TestValidateNotWellFormed(t *testing.T) {
+	violations := validate(t, header+description+"<body><section><p>a &nbsp; b</p></section></body></FictionBook>")
+	assert.Equal(t, []Kind{NotWellFormed}, kinds(violations))
+	assert.Equal(t, 6, violations[0].Line)
+
+	violations = validate(t, header+description+"<body><section><p>a</section></body></FictionBook>")
+	assert.Equal(t, []Kind{NotWellFormed}, kinds(violations))
+}
+
+func TestValidateNamespace(t *testing.T) {
+	violations := validate(t, `<?xml version="1.0"?><FictionBook><body/></FictionBook>`)
+	assert.Equal(t, WrongNamespace, violations[0].Kind)
+	assert.Equal(t, "/FictionBook", violations[0].Path)
+}
+
+func TestValidateBook(t *testing.T) {
+	data, err := os.ReadFile("../fb2/testdata/177692.fb2")
+	assert.NoError(t, err)
+	book, err := fb2.ParseFictionBook(data)
+	assert.NoError(t, err)
+
+	violations, err := FictionBook().ValidateBook(book)
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+}
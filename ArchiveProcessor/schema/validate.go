@@ -0,0 +1,365 @@
+package schema
+
+import (
+	"ArchiveProcessor/fb2"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// maxSimpleText caps the text collected for checking simple values.
+const maxSimpleText = 4096
+
+// Kind classifies violations.
+type Kind string
+
+const (
+	NotWellFormed     Kind = "not-well-formed"
+	UnexpectedElement Kind = "unexpected-element"
+	MissingElement    Kind = "missing-element"
+	WrongNamespace    Kind = "wrong-namespace"
+	UnexpectedText    Kind = "unexpected-text"
+	UnknownAttribute  Kind = "unknown-attribute"
+	MissingAttribute  Kind = "missing-attribute"
+	InvalidValue      Kind = "invalid-value"
+	DuplicateID       Kind = "duplicate-id"
+)
+
+// Violation is a single schema violation. Path is an XPath-like location such
+// as /FictionBook/body[1]/section[2]/p[5], with element positions counted
+// among siblings of the same name.
+type Violation struct {
+	Kind     Kind     `json:"kind"`
+	Path     string   `json:"path"`
+	Line     int      `json:"line"`
+	Message  string   `json:"message"`
+	Value    string   `json:"value,omitempty"`
+	Expected []string `json:"expected,omitempty"`
+}
+
+func (v Violation) String() string {
+	s := fmt.Sprintf("%s:%d: %s", v.Path, v.Line, v.Message)
+	if v.Value != "" {
+		s += fmt.Sprintf(" %q", v.Value)
+	}
+	if len(v.Expected) > 0 {
+		s += ", expected one of " + strings.Join(v.Expected, ", ")
+	}
+	return s
+}
+
+type frame struct {
+	name   string
+	path   string
+	typ    *typeDef
+	state  stateSet
+	counts map[string]int
+	text   strings.Builder
+	// textReported is set once unexpected text has been reported.
+	textReported bool
+}
+
+type validator struct {
+	schema     *Schema
+	d          *xml.Decoder
+	stack      []*frame
+	ids        map[string]bool
+	violations []Violation
+	seenRoot   bool
+}
+
+// Validate checks the FB2 document in r. The document is decoded as
+// fb2.NewDecodingReader does. A document that is not well-formed yields a
+// NotWellFormed violation after the ones found before the error; errors
+// are only returned for failed reads.
+func (s *Schema) Validate(r io.Reader) ([]Violation, error) {
+	decoded, _, err := fb2.NewDecodingReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	d := xml.NewDecoder(decoded)
+	d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	v := &validator{schema: s, d: d, ids: make(map[string]bool)}
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		var syntaxErr *xml.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			v.report(NotWellFormed, syntaxErr.Msg, "", nil)
+			v.violations[len(v.violations)-1].Line = syntaxErr.Line
+			return v.violations, nil
+		}
+		if err != nil {
+			return v.violations, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			v.start(t)
+		case xml.EndElement:
+			v.end()
+		case xml.CharData:
+			v.chardata(t)
+		}
+	}
+
+	if !v.seenRoot {
+		v.report(MissingElement, "document has no root element", "", nil)
+	}
+	return v.violations, nil
+}
+
+// ValidateBook checks a parsed book by validating its serialized form, see
+// fb2.Marshal. Paths refer to the serialized document.
+func (s *Schema) ValidateBook(book *fb2.FictionBook) ([]Violation, error) {
+	data, err := fb2.Marshal(book)
+	if err != nil {
+		return nil, err
+	}
+	return s.Validate(bytes.NewReader(data))
+}
+
+func (v *validator) top() *frame {
+	if len(v.stack) == 0 {
+		return nil
+	}
+	return v.stack[len(v.stack)-1]
+}
+
+func (v *validator) report(kind Kind, message, value string, expected []string) {
+	line, _ := v.d.InputPos()
+	path := "/"
+	if f := v.top(); f != nil {
+		path = f.path
+	}
+	v.violations = append(v.violations, Violation{
+		Kind:     kind,
+		Path:     path,
+		Line:     line,
+		Message:  message,
+		Value:    value,
+		Expected: expected,
+	})
+}
+
+func (v *validator) start(t xml.StartElement) {
+	name := t.Name.Local
+	parent := v.top()
+
+	f := &frame{name: name}
+	if parent == nil {
+		f.path = "/" + name
+	} else {
+		if parent.counts == nil {
+			parent.counts = make(map[string]int)
+		}
+		parent.counts[name]++
+		f.path = fmt.Sprintf("%s/%s[%d]", parent.path, name, parent.counts[name])
+	}
+	v.stack = append(v.stack, f)
+
+	if t.Name.Space != v.schema.Namespace {
+		v.report(WrongNamespace, fmt.Sprintf("element <%s> is not in the FB2 namespace", name), t.Name.Space, nil)
+	}
+
+	switch {
+	case parent == nil:
+		if v.seenRoot {
+			v.report(UnexpectedElement, fmt.Sprintf("second root element <%s>", name), "", nil)
+			return
+		}
+		v.seenRoot = true
+		decl, ok := v.schema.elements[name]
+		if !ok {
+			v.report(UnexpectedElement, fmt.Sprintf("unknown root element <%s>", name), "", nil)
+			return
+		}
+		f.typ = decl.typ
+	case parent.typ == nil:
+		// Content of unknown or untyped elements is not checked.
+		return
+	case parent.typ.simple != nil:
+		v.report(UnexpectedElement, fmt.Sprintf("element <%s> in text-only <%s>", name, parent.name), "", nil)
+		return
+	default:
+		next, decl := parent.typ.model.step(parent.state, name)
+		if decl == nil {
+			v.report(UnexpectedElement, fmt.Sprintf("unexpected element <%s> in <%s>", name, parent.name),
+				"", parent.typ.model.expected(parent.state))
+			return
+		}
+		parent.state = next
+		f.typ = decl.typ
+	}
+
+	if f.typ == nil {
+		return
+	}
+	if f.typ.model != nil {
+		f.state = f.typ.model.initial()
+	}
+	v.checkAttrs(f, t.Attr)
+}
+
+func (v *validator) checkAttrs(f *frame, attrs []xml.Attr) {
+	present := make(map[xml.Name]bool, len(attrs))
+	for _, a := range attrs {
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+
+		var decl *attrDecl
+		for i := range f.typ.attrs {
+			if f.typ.attrs[i].name == a.Name {
+				decl = &f.typ.attrs[i]
+				break
+			}
+		}
+		if decl == nil {
+			v.report(UnknownAttribute, fmt.Sprintf("attribute %s not allowed on <%s>", attrName(a.Name), f.name), "", nil)
+			continue
+		}
+
+		present[a.Name] = true
+		if decl.typ == nil {
+			continue
+		}
+		if !checkSimple(decl.typ, a.Value) {
+			v.report(InvalidValue, fmt.Sprintf("invalid %s value of attribute %s", decl.typ.name, attrName(a.Name)),
+				a.Value, decl.typ.enumeration)
+			continue
+		}
+		if decl.typ.name == "ID" {
+			if v.ids[a.Value] {
+				v.report(DuplicateID, fmt.Sprintf("duplicate id on <%s>", f.name), a.Value, nil)
+			}
+			v.ids[a.Value] = true
+		}
+	}
+
+	for _, decl := range f.typ.attrs {
+		if decl.required && !present[decl.name] {
+			v.report(MissingAttribute, fmt.Sprintf("missing attribute %s on <%s>", attrName(decl.name), f.name), "", nil)
+		}
+	}
+}
+
+func attrName(n xml.Name) string {
+	switch n.Space {
+	case "":
+		return n.Local
+	case xmlNamespace:
+		return "xml:" + n.Local
+	case fb2.XLinkNamespace:
+		return "xlink:" + n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+func (v *validator) end() {
+	f := v.top()
+	defer func() {
+		v.stack = v.stack[:len(v.stack)-1]
+	}()
+
+	switch {
+	case f.typ == nil:
+	case f.typ.simple != nil:
+		if f.typ.simple.name != "base64Binary" && !checkSimple(f.typ.simple, f.text.String()) {
+			v.report(InvalidValue, fmt.Sprintf("invalid %s value of <%s>", f.typ.simple.name, f.name),
+				f.text.String(), f.typ.simple.enumeration)
+		}
+	case !f.typ.model.accepts(f.state):
+		v.report(MissingElement, fmt.Sprintf("incomplete content of <%s>", f.name), "", f.typ.model.expected(f.state))
+	}
+}
+
+func (v *validator) chardata(text xml.CharData) {
+	f := v.top()
+	if f == nil || f.typ == nil {
+		return
+	}
+
+	if f.typ.simple != nil {
+		if f.typ.simple.name == "base64Binary" {
+			if i := bytes.IndexFunc(text, func(r rune) bool { return !isBase64(r) }); i >= 0 && !f.textReported {
+				f.textReported = true
+				v.report(InvalidValue, fmt.Sprintf("invalid base64Binary content of <%s>", f.name), string(text[i:i+1]), nil)
+			}
+			return
+		}
+		if f.text.Len() < maxSimpleText {
+			f.text.Write(text)
+		}
+		return
+	}
+
+	if !f.typ.mixed && !f.textReported && len(bytes.TrimSpace(text)) > 0 {
+		f.textReported = true
+		v.report(UnexpectedText, fmt.Sprintf("text not allowed in <%s>", f.name), truncate(string(bytes.TrimSpace(text)), 40), nil)
+	}
+}
+
+func isBase64(r rune) bool {
+	return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' ||
+		r == '+' || r == '/' || r == '=' || r == ' ' || r == '\t' || r == '\r' || r == '\n'
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
+
+var (
+	integerPattern = regexp.MustCompile(`^[+-]?[0-9]+$`)
+	gYearPattern   = regexp.MustCompile(`^-?[0-9]{4,}(Z|[+-][0-9]{2}:[0-9]{2})?$`)
+	datePattern    = regexp.MustCompile(`^-?[0-9]{4,}-(0[1-9]|1[0-2])-(0[1-9]|[12][0-9]|3[01])(Z|[+-][0-9]{2}:[0-9]{2})?$`)
+	ncNamePattern  = regexp.MustCompile(`^[\p{L}_][\p{L}\p{N}._\-\x{B7}\p{Mn}\p{Mc}]*$`)
+)
+
+// checkSimple reports whether value is valid for a simple type.
+func checkSimple(st *simpleType, value string) bool {
+	value = strings.TrimSpace(value)
+	if len(st.enumeration) > 0 {
+		for _, e := range st.enumeration {
+			if value == e {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch st.name {
+	case "integer":
+		return integerPattern.MatchString(value)
+	case "float":
+		if value == "INF" || value == "-INF" || value == "NaN" {
+			return true
+		}
+		_, err := strconv.ParseFloat(value, 32)
+		return err == nil
+	case "gYear":
+		return gYearPattern.MatchString(value)
+	case "date":
+		return datePattern.MatchString(value)
+	case "ID":
+		return ncNamePattern.MatchString(value)
+	}
+	return true
+}
@@ -0,0 +1,227 @@
+// Package segment splits Russian text into sentences, and packs sentences
+// into segments of bounded length.
+//
+// A sentence ends at ., !, ? or an ellipsis, with any closing quotes and
+// brackets after it, if the next sentence starts with a capital letter or a
+// digit, possibly behind a dialogue dash or an opening quote. Initials and
+// the abbreviations that precede names and numbers, such as "г." or "проф.",
+// do not end a sentence. A line break always does.
+package segment
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// noBreak are the abbreviations, lower-cased and without their final dot,
+// after which a capitalized word or a number does not start a new sentence.
+var noBreak = map[string]bool{
+	// Titles and forms of address.
+	"г-н": true, "г-жа": true, "тов": true, "гр": true, "св": true,
+	"проф": true, "акад": true, "доц": true, "ген": true, "полк": true,
+	"кап": true, "лейт": true, "дж": true, "mr": true, "mrs": true, "ms": true,
+	"dr": true, "st": true,
+	// Places.
+	"ул": true, "пр": true, "пер": true, "пл": true, "наб": true, "д": true,
+	"кв": true, "обл": true, "пос": true, "дер": true, "р": true, "оз": true,
+	"им": true,
+	// References.
+	"см": true, "ср": true, "рис": true, "табл": true, "гл": true, "стр": true,
+	"с": true, "т": true, "ч": true, "вып": true, "изд": true, "ред": true,
+	"напр": true, "ок": true, "англ": true, "лат": true, "нем": true,
+	"франц": true, "греч": true, "род": true, "ум": true, "№": true,
+}
+
+// Sentences returns the sentences of text, with surrounding whitespace
+// removed.
+func Sentences(text string) []string {
+	var sentences []string
+	for _, line := range strings.Split(text, "\n") {
+		sentences = appendSentences(sentences, line)
+	}
+	return sentences
+}
+
+func appendSentences(sentences []string, line string) []string {
+	add := func(s string) {
+		if s = strings.TrimSpace(s); s != "" {
+			sentences = append(sentences, s)
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if !isTerminator(r) {
+			i += size
+			continue
+		}
+
+		// The run of terminators and closing quotes and brackets.
+		end := i + size
+		for end < len(line) {
+			r, size := utf8.DecodeRuneInString(line[end:])
+			if !isTerminator(r) && !isCloser(r) {
+				break
+			}
+			end += size
+		}
+		if isBoundary(line, start, i, end) {
+			add(line[start:end])
+			start = end
+		}
+		i = end
+	}
+	add(line[start:])
+	return sentences
+}
+
+// isBoundary reports whether the sentence started at start ends with the
+// terminators at line[i:end].
+func isBoundary(line string, start, i, end int) bool {
+	if end == len(line) {
+		return true
+	}
+	next, _ := utf8.DecodeRuneInString(line[end:])
+	if !unicode.IsSpace(next) {
+		// Inside a number, an abbreviation such as "т.е." or a URL.
+		return false
+	}
+	if !startsSentence(line[end:]) {
+		return false
+	}
+	if line[i:end] != "." {
+		return true
+	}
+	return !isAbbreviation(line[start:i])
+}
+
+// startsSentence reports whether s, after spaces, dashes and opening quotes,
+// starts with a capital letter or a digit.
+func startsSentence(s string) bool {
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r) || isDash(r) || isOpener(r):
+			continue
+		case unicode.IsUpper(r) || unicode.IsDigit(r):
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// isAbbreviation reports whether the last word of s, which is followed by a
+// dot, is an initial or one of noBreak.
+func isAbbreviation(s string) bool {
+	word := s[strings.LastIndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || isOpener(r)
+	})+1:]
+	if word == "" {
+		return false
+	}
+
+	// Initials, as in "А. Я. Живой" or "А.Я. Живой".
+	initials := true
+	for n, part := range strings.Split(word, ".") {
+		if utf8.RuneCountInString(part) != 1 || n == 0 && !unicode.IsUpper([]rune(part)[0]) {
+			initials = false
+			break
+		}
+	}
+	if initials {
+		return true
+	}
+
+	before := strings.TrimRightFunc(s[:len(s)-len(word)], unicode.IsSpace)
+	word = strings.ToLower(word)
+	previous := strings.ToLower(before[strings.LastIndexFunc(before, unicode.IsSpace)+1:])
+	if previous == "т." || previous == "и" && (word == "пр" || word == "др") {
+		// The end of "т. д.", "т. п." or "и пр.", which may end a sentence.
+		return false
+	}
+	if word == "г" || word == "в" {
+		// A year or a century when it follows a number, as in "в 1990 г.",
+		// otherwise a city, as in "г. Москва", or a name.
+		last, _ := utf8.DecodeLastRuneInString(before)
+		return !unicode.IsDigit(last) && !isRoman(before)
+	}
+	return noBreak[word]
+}
+
+// isRoman reports whether s ends with a roman numeral, as in "XIX в.".
+func isRoman(s string) bool {
+	word := s[strings.LastIndexFunc(s, unicode.IsSpace)+1:]
+	if word == "" {
+		return false
+	}
+	for _, r := range word {
+		if !strings.ContainsRune("IVXLC", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTerminator(r rune) bool {
+	return r == '.' || r == '!' || r == '?' || r == '…'
+}
+
+func isCloser(r rune) bool {
+	return strings.ContainsRune(`»"”’')]`, r)
+}
+
+func isOpener(r rune) bool {
+	return strings.ContainsRune(`«"„“‘'([`, r)
+}
+
+func isDash(r rune) bool {
+	return r == '—' || r == '–' || r == '-'
+}
+
+// Pack joins consecutive sentences into segments of at most maxRunes runes.
+// A sentence longer than that is split between words, and a word longer
+// than that on its own. maxRunes must be positive.
+func Pack(sentences []string, maxRunes int) []string {
+	var segments []string
+	var segment strings.Builder
+	size := 0
+	flush := func() {
+		if size > 0 {
+			segments = append(segments, segment.String())
+			segment.Reset()
+			size = 0
+		}
+	}
+	add := func(s string, n int) {
+		if size > 0 && size+1+n > maxRunes {
+			flush()
+		}
+		if size > 0 {
+			segment.WriteByte(' ')
+			size++
+		}
+		segment.WriteString(s)
+		size += n
+	}
+
+	for _, sentence := range sentences {
+		if n := utf8.RuneCountInString(sentence); n <= maxRunes {
+			add(sentence, n)
+			continue
+		}
+		for _, word := range strings.Fields(sentence) {
+			for utf8.RuneCountInString(word) > maxRunes {
+				flush()
+				cut := len(string([]rune(word)[:maxRunes]))
+				segments = append(segments, word[:cut])
+				word = word[cut:]
+			}
+			add(word, utf8.RuneCountInString(word))
+		}
+	}
+	flush()
+	return segments
+}
@@ -0,0 +1,51 @@
+package segment
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Вечер был тихим. Никто не спал.", []string{"Вечер был тихим.", "Никто не спал."}},
+		{"Кто там? Никого! Странно…", []string{"Кто там?", "Никого!", "Странно…"}},
+		{"Рассказ написал А. Я. Живой в 1990 г. Потом его забыли.", []string{"Рассказ написал А. Я. Живой в 1990 г.", "Потом его забыли."}},
+		{"Их прислал А.Я. Живой из г. Москва.", []string{"Их прислал А.Я. Живой из г. Москва."}},
+		{"Это было в XIX в. Тогда всё было иначе.", []string{"Это было в XIX в.", "Тогда всё было иначе."}},
+		{"Живёт на ул. Ленина, д. 5. См. Рис. 3.", []string{"Живёт на ул. Ленина, д. 5.", "См. Рис. 3."}},
+		{"Книги, журналы и т. д. Всё сгорело.", []string{"Книги, журналы и т. д.", "Всё сгорело."}},
+		{"Т.е. всё так. Число 3.14 верно.", []string{"Т.е. всё так.", "Число 3.14 верно."}},
+		{"Ну... ладно. Ну... Ладно.", []string{"Ну... ладно.", "Ну...", "Ладно."}},
+		// Dialogue.
+		{"— Привет! — сказал он. — Ты откуда?", []string{"— Привет! — сказал он.", "— Ты откуда?"}},
+		{"— Стой! — Он обернулся.", []string{"— Стой!", "— Он обернулся."}},
+		// Quotes.
+		{"«Ты придёшь?» — спросил он. «Да.» Она ушла.", []string{"«Ты придёшь?» — спросил он.", "«Да.»", "Она ушла."}},
+		{"Он сказал: «Всё кончено». «Нет!» — крикнула она.", []string{"Он сказал: «Всё кончено».", "«Нет!» — крикнула она."}},
+		// Paragraphs.
+		{"Глава первая\nБыло утро.\n\n  Шёл дождь  ", []string{"Глава первая", "Было утро.", "Шёл дождь"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Sentences(tt.text), tt.text)
+	}
+}
+
+func TestPack(t *testing.T) {
+	sentences := []string{"Раз два.", "Три.", "Четыре пять шесть семь.", "Восемь."}
+	assert.Equal(t, []string{"Раз два. Три.", "Четыре пять", "шесть семь.", "Восемь."}, Pack(sentences, 13))
+	assert.Equal(t, []string{"Раз два. Три. Четыре пять шесть семь. Восемь."}, Pack(sentences, 100))
+	assert.Equal(t, []string{"Очень", "длинн", "ое", "слово"}, Pack([]string{"Очень длинное слово"}, 5))
+	assert.Nil(t, Pack(nil, 10))
+
+	for _, segment := range Pack(Sentences(strings.Repeat("Съешь же ещё этих мягких французских булок. ", 20)), 50) {
+		assert.LessOrEqual(t, utf8.RuneCountInString(segment), 50)
+		assert.True(t, utf8.ValidString(segment))
+	}
+}
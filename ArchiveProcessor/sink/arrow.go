@@ -0,0 +1,323 @@
+package sink
+
+import (
+	"ArchiveProcessor/fb2"
+	"encoding/binary"
+	"io"
+)
+
+// Arrow constants, from Schema.fbs, Message.fbs and File.fbs.
+const (
+	arrowMagic           = "ARROW1"
+	arrowMetadataV5      = 4 // MetadataVersion
+	arrowTypeUtf8        = 5 // Type
+	arrowHeaderSchema    = 1 // MessageHeader
+	arrowHeaderBatch     = 3 // MessageHeader
+	arrowContinuation    = 0xffffffff
+	arrowBufferAlignment = 8
+)
+
+// arrowBlock locates a record batch in the file footer.
+type arrowBlock struct {
+	offset         int64
+	metadataLength int32
+	bodyLength     int64
+}
+
+// arrowSink writes an Arrow IPC file, as read by pandas.read_feather or
+// pyarrow.ipc.open_file, with a non-nullable utf8 column per header column.
+type arrowSink struct {
+	w       *countingWriter
+	layout  Columns
+	columns []string
+	batch   [][]string
+	size    int
+	blocks  []arrowBlock
+}
+
+func newArrow(w io.Writer, columns Columns) (Sink, error) {
+	s := &arrowSink{w: &countingWriter{w: w}, layout: columns, columns: columns.Header()}
+	s.w.Write([]byte(arrowMagic))
+	s.w.pad(arrowBufferAlignment)
+	s.writeMessage(arrowHeaderSchema, s.schema(), nil)
+	return s, s.w.err
+}
+
+func (s *arrowSink) Write(rec *fb2.Record) error {
+	row := s.layout.Row(rec)
+	s.batch = append(s.batch, row)
+	for _, v := range row {
+		s.size += len(v)
+	}
+	if len(s.batch) >= batchRows || s.size >= maxBatchBytes {
+		return s.flush()
+	}
+	return nil
+}
+
+// schema returns the Schema table.
+func (s *arrowSink) schema() *fbTable {
+	fields := make([]*fbTable, len(s.columns))
+	for i, name := range s.columns {
+		field := &fbTable{}
+		field.ref(0, fbString(name))
+		field.scalar(1, 1, 0) // nullable
+		field.scalar(2, 1, arrowTypeUtf8)
+		field.ref(3, &fbTable{})
+		field.ref(5, fbTables{})
+		fields[i] = field
+	}
+	schema := &fbTable{}
+	schema.scalar(0, 2, 0) // little endian
+	schema.ref(1, fbTables(fields))
+	return schema
+}
+
+func (s *arrowSink) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+
+	// Each column has an empty validity buffer, as there are no nulls, an
+	// offsets buffer and a data buffer.
+	var body []byte
+	var nodes, buffers []byte
+	addBuffer := func(data []byte) {
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(body)))
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(data)))
+		body = append(body, data...)
+		for len(body)%arrowBufferAlignment != 0 {
+			body = append(body, 0)
+		}
+	}
+	for col := range s.columns {
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(len(s.batch)))
+		nodes = binary.LittleEndian.AppendUint64(nodes, 0)
+
+		offsets := binary.LittleEndian.AppendUint32(nil, 0)
+		var data []byte
+		for _, row := range s.batch {
+			data = append(data, row[col]...)
+			offsets = binary.LittleEndian.AppendUint32(offsets, uint32(len(data)))
+		}
+		addBuffer(nil)
+		addBuffer(offsets)
+		addBuffer(data)
+	}
+
+	batch := &fbTable{}
+	batch.scalar(0, 8, uint64(len(s.batch)))
+	batch.ref(1, fbStructs{align: 8, data: nodes, n: len(s.columns)})
+	batch.ref(2, fbStructs{align: 8, data: buffers, n: 3 * len(s.columns)})
+	s.blocks = append(s.blocks, s.writeMessage(arrowHeaderBatch, batch, body))
+
+	s.batch = s.batch[:0]
+	s.size = 0
+	return s.w.err
+}
+
+// writeMessage writes an encapsulated message: a continuation marker, the
+// length of the Message flatbuffer, the flatbuffer and the body.
+func (s *arrowSink) writeMessage(headerType byte, header *fbTable, body []byte) arrowBlock {
+	message := &fbTable{}
+	message.scalar(0, 2, arrowMetadataV5)
+	message.scalar(1, 1, uint64(headerType))
+	message.ref(2, header)
+	message.scalar(3, 8, uint64(len(body)))
+	metadata := buildFlatbuffer(message)
+
+	block := arrowBlock{offset: s.w.n, metadataLength: int32(8 + len(metadata)), bodyLength: int64(len(body))}
+	var prefix []byte
+	prefix = binary.LittleEndian.AppendUint32(prefix, arrowContinuation)
+	prefix = binary.LittleEndian.AppendUint32(prefix, uint32(len(metadata)))
+	s.w.Write(prefix)
+	s.w.Write(metadata)
+	s.w.Write(body)
+	return block
+}
+
+func (s *arrowSink) Close() error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	// End of stream, then the footer.
+	var eos []byte
+	eos = binary.LittleEndian.AppendUint32(eos, arrowContinuation)
+	eos = binary.LittleEndian.AppendUint32(eos, 0)
+	s.w.Write(eos)
+
+	var blocks []byte
+	for _, b := range s.blocks {
+		blocks = binary.LittleEndian.AppendUint64(blocks, uint64(b.offset))
+		blocks = binary.LittleEndian.AppendUint32(blocks, uint32(b.metadataLength))
+		blocks = binary.LittleEndian.AppendUint32(blocks, 0)
+		blocks = binary.LittleEndian.AppendUint64(blocks, uint64(b.bodyLength))
+	}
+	footer := &fbTable{}
+	footer.scalar(0, 2, arrowMetadataV5)
+	footer.ref(1, s.schema())
+	footer.ref(2, fbStructs{align: 8})
+	footer.ref(3, fbStructs{align: 8, data: blocks, n: len(s.blocks)})
+	data := buildFlatbuffer(footer)
+
+	s.w.Write(data)
+	s.w.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(data))))
+	s.w.Write([]byte(arrowMagic))
+	return s.w.err
+}
+
+// A minimal FlatBuffers encoder, enough for the Arrow metadata. Objects are
+// laid out front to back: a table is followed by the objects it refers to,
+// so all offsets point forward as the format requires.
+
+// fbTable is a table under construction. Fields are indexed by id.
+type fbTable struct {
+	fields []fbField
+}
+
+// fbField is a scalar of 1, 2, 4 or 8 bytes or, with ref set, an offset to
+// an fbString, fbTables, fbStructs or *fbTable.
+type fbField struct {
+	size  int
+	value uint64
+	ref   interface{}
+}
+
+type fbString string
+
+// fbTables is a vector of tables.
+type fbTables []*fbTable
+
+// fbStructs is a vector of n structs, encoded in data.
+type fbStructs struct {
+	align int
+	data  []byte
+	n     int
+}
+
+func (t *fbTable) set(id int, f fbField) {
+	for len(t.fields) <= id {
+		t.fields = append(t.fields, fbField{})
+	}
+	t.fields[id] = f
+}
+
+func (t *fbTable) scalar(id, size int, value uint64) {
+	t.set(id, fbField{size: size, value: value})
+}
+
+func (t *fbTable) ref(id int, obj interface{}) {
+	t.set(id, fbField{size: 4, ref: obj})
+}
+
+// buildFlatbuffer encodes root, padded to a multiple of 8 bytes.
+func buildFlatbuffer(root *fbTable) []byte {
+	b := &fbBuilder{buf: make([]byte, 4)}
+	b.patch(0, b.table(root))
+	b.align(8)
+	return b.buf
+}
+
+type fbBuilder struct {
+	buf []byte
+}
+
+func (b *fbBuilder) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// patch points the offset at slot to pos.
+func (b *fbBuilder) patch(slot, pos int) {
+	binary.LittleEndian.PutUint32(b.buf[slot:], uint32(pos-slot))
+}
+
+func (b *fbBuilder) place(obj interface{}) int {
+	switch obj := obj.(type) {
+	case *fbTable:
+		return b.table(obj)
+	case fbString:
+		b.align(4)
+		pos := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(obj)))
+		b.buf = append(append(b.buf, obj...), 0)
+		return pos
+	case fbTables:
+		b.align(4)
+		pos := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(obj)))
+		slots := len(b.buf)
+		b.buf = append(b.buf, make([]byte, 4*len(obj))...)
+		for i, t := range obj {
+			b.patch(slots+4*i, b.table(t))
+		}
+		return pos
+	case fbStructs:
+		// The elements, after the length, are aligned.
+		b.align(4)
+		for (len(b.buf)+4)%obj.align != 0 {
+			b.buf = append(b.buf, 0)
+		}
+		pos := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(obj.n))
+		b.buf = append(b.buf, obj.data...)
+		return pos
+	}
+	panic("flatbuffers: unknown object")
+}
+
+// table writes the vtable, then the table, then the objects it refers to,
+// and returns the position of the table.
+func (b *fbBuilder) table(t *fbTable) int {
+	b.align(2)
+	vtable := len(b.buf)
+	vtableSize := 4 + 2*len(t.fields)
+
+	// Lay out the fields after the soffset to the vtable, each aligned to
+	// its size.
+	pos := vtable + vtableSize
+	pos += (4 - pos%4) % 4
+	offsets := make([]int, len(t.fields))
+	end := pos + 4
+	for i, f := range t.fields {
+		if f.size == 0 {
+			continue
+		}
+		end += (f.size - end%f.size) % f.size
+		offsets[i] = end - pos
+		end += f.size
+	}
+
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(vtableSize))
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(end-pos))
+	for _, off := range offsets {
+		b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(off))
+	}
+	b.buf = append(b.buf, make([]byte, end-len(b.buf))...)
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(pos-vtable))
+	for i, f := range t.fields {
+		if f.size == 0 || f.ref != nil {
+			continue
+		}
+		slot := b.buf[pos+offsets[i]:]
+		switch f.size {
+		case 1:
+			slot[0] = byte(f.value)
+		case 2:
+			binary.LittleEndian.PutUint16(slot, uint16(f.value))
+		case 4:
+			binary.LittleEndian.PutUint32(slot, uint32(f.value))
+		case 8:
+			binary.LittleEndian.PutUint64(slot, f.value)
+		}
+	}
+
+	for i, f := range t.fields {
+		if f.ref != nil {
+			b.patch(pos+offsets[i], b.place(f.ref))
+		}
+	}
+	return pos
+}
@@ -0,0 +1,204 @@
+package sink
+
+import (
+	"encoding/binary"
+	"testing"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// The tests read the Arrow metadata with the FlatBuffers runtime, rather
+// than with code mirroring fbBuilder, so that a misreading of the format does
+// not cancel out. The ids are those of the fields in Schema.fbs, Message.fbs
+// and File.fbs, and alignment is checked as the Arrow readers verify it.
+
+func aligned(t *testing.T, pos flatbuffers.UOffsetT, n int) flatbuffers.UOffsetT {
+	assert.Zero(t, int(pos)%n, "position %d not aligned to %d", pos, n)
+	return pos
+}
+
+func fbRoot(buf []byte) *flatbuffers.Table {
+	return &flatbuffers.Table{Bytes: buf, Pos: flatbuffers.GetUOffsetT(buf)}
+}
+
+// fbOffset returns the offset of field id from the start of table, or 0.
+func fbOffset(table *flatbuffers.Table, id int) flatbuffers.UOffsetT {
+	return flatbuffers.UOffsetT(table.Offset(flatbuffers.VOffsetT(4 + 2*id)))
+}
+
+func fbScalar(t *testing.T, table *flatbuffers.Table, id, size int) uint64 {
+	off := fbOffset(table, id)
+	if off == 0 {
+		return 0
+	}
+	pos := aligned(t, table.Pos+off, size)
+	switch size {
+	case 1:
+		return uint64(table.GetUint8(pos))
+	case 2:
+		return uint64(table.GetUint16(pos))
+	case 4:
+		return uint64(table.GetUint32(pos))
+	}
+	return table.GetUint64(pos)
+}
+
+func fbChild(table *flatbuffers.Table, id int) *flatbuffers.Table {
+	off := fbOffset(table, id)
+	if off == 0 {
+		return nil
+	}
+	return &flatbuffers.Table{Bytes: table.Bytes, Pos: table.Indirect(table.Pos + off)}
+}
+
+func fbText(t *testing.T, table *flatbuffers.Table, id int) string {
+	off := fbOffset(table, id)
+	s := table.String(table.Pos + off)
+	end := table.Indirect(table.Pos+off) + 4 + flatbuffers.UOffsetT(len(s))
+	assert.Zero(t, table.Bytes[end], "strings end with a zero byte")
+	return s
+}
+
+// fbVector returns the length and the position of the first element of a
+// vector field.
+func fbVector(t *testing.T, table *flatbuffers.Table, id int) (int, flatbuffers.UOffsetT) {
+	off := fbOffset(table, id)
+	if !assert.NotZero(t, off, "vector %d", id) {
+		return 0, 0
+	}
+	return table.VectorLen(off), aligned(t, table.Vector(off), 4)
+}
+
+// fbElem returns the table a vector element at pos points to.
+func fbElem(table *flatbuffers.Table, pos flatbuffers.UOffsetT) *flatbuffers.Table {
+	return &flatbuffers.Table{Bytes: table.Bytes, Pos: table.Indirect(pos)}
+}
+
+func TestFlatbuffer(t *testing.T) {
+	root := &fbTable{}
+	root.scalar(0, 1, 7)
+	root.scalar(2, 8, 1<<40)
+	root.ref(3, fbString("name"))
+	child := &fbTable{}
+	child.scalar(0, 2, 5)
+	root.ref(4, fbTables{child, {}})
+	root.ref(5, fbStructs{align: 8, data: make([]byte, 16), n: 1})
+	buf := buildFlatbuffer(root)
+	assert.Zero(t, len(buf)%8)
+
+	table := fbRoot(buf)
+	assert.Equal(t, uint64(7), fbScalar(t, table, 0, 1))
+	assert.Zero(t, fbOffset(table, 1))
+	assert.Equal(t, uint64(1<<40), fbScalar(t, table, 2, 8))
+	assert.Equal(t, "name", fbText(t, table, 3))
+	n, first := fbVector(t, table, 4)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, uint64(5), fbScalar(t, fbElem(table, first), 0, 2))
+	assert.Zero(t, fbOffset(fbElem(table, first+4), 0))
+	n, first = fbVector(t, table, 5)
+	assert.Equal(t, 1, n)
+	aligned(t, first, 8)
+	assert.Zero(t, fbOffset(table, 9))
+}
+
+func readArrow(t *testing.T, data []byte) ([]string, [][]string) {
+	assert.Equal(t, arrowMagic+"\x00\x00", string(data[:8]))
+	assert.Equal(t, arrowMagic, string(data[len(data)-6:]))
+	length := int(binary.LittleEndian.Uint32(data[len(data)-10:]))
+	footer := fbRoot(data[len(data)-10-length : len(data)-10])
+	assert.Equal(t, uint64(arrowMetadataV5), fbScalar(t, footer, 0, 2))
+
+	// Schema.fields, then Field.name, nullable, type_type and children.
+	var names []string
+	schema := fbChild(footer, 1)
+	assert.Zero(t, fbScalar(t, schema, 0, 2), "little endian")
+	n, first := fbVector(t, schema, 1)
+	for i := 0; i < n; i++ {
+		field := fbElem(schema, first+flatbuffers.UOffsetT(4*i))
+		names = append(names, fbText(t, field, 0))
+		assert.Zero(t, fbScalar(t, field, 1, 1), "not nullable")
+		assert.Equal(t, uint64(arrowTypeUtf8), fbScalar(t, field, 2, 1))
+		assert.NotNil(t, fbChild(field, 3))
+		children, _ := fbVector(t, field, 5)
+		assert.Zero(t, children)
+	}
+
+	// The schema message comes first.
+	assert.Equal(t, uint32(arrowContinuation), binary.LittleEndian.Uint32(data[8:]))
+	schemaMessage := fbRoot(data[16 : 16+binary.LittleEndian.Uint32(data[12:])])
+	assert.Equal(t, uint64(arrowMetadataV5), fbScalar(t, schemaMessage, 0, 2))
+	assert.Equal(t, uint64(arrowHeaderSchema), fbScalar(t, schemaMessage, 1, 1))
+
+	// Footer.recordBatches, Block structs of offset, metaDataLength and
+	// bodyLength.
+	var rows [][]string
+	blocks, first := fbVector(t, footer, 3)
+	aligned(t, first, 8)
+	for i := 0; i < blocks; i++ {
+		block := footer.Bytes[int(first)+24*i:]
+		offset := int(binary.LittleEndian.Uint64(block))
+		metadataLength := int(binary.LittleEndian.Uint32(block[8:]))
+		bodyLength := int(binary.LittleEndian.Uint64(block[16:]))
+		assert.Zero(t, offset%8)
+		assert.Zero(t, metadataLength%8)
+		assert.Equal(t, uint32(arrowContinuation), binary.LittleEndian.Uint32(data[offset:]))
+		assert.Equal(t, metadataLength-8, int(binary.LittleEndian.Uint32(data[offset+4:])))
+
+		// Message.version, header_type, header and bodyLength.
+		message := fbRoot(data[offset+8 : offset+metadataLength])
+		assert.Equal(t, uint64(arrowMetadataV5), fbScalar(t, message, 0, 2))
+		assert.Equal(t, uint64(arrowHeaderBatch), fbScalar(t, message, 1, 1))
+		assert.Equal(t, uint64(bodyLength), fbScalar(t, message, 3, 8))
+		body := data[offset+metadataLength : offset+metadataLength+bodyLength]
+
+		// RecordBatch.length, nodes and buffers.
+		batch := fbChild(message, 2)
+		length := int(fbScalar(t, batch, 0, 8))
+		start := len(rows)
+		for j := 0; j < length; j++ {
+			rows = append(rows, make([]string, len(names)))
+		}
+		nodes, firstNode := fbVector(t, batch, 1)
+		assert.Equal(t, len(names), nodes)
+		aligned(t, firstNode, 8)
+		buffers, firstBuffer := fbVector(t, batch, 2)
+		assert.Equal(t, 3*len(names), buffers)
+		aligned(t, firstBuffer, 8)
+		buffer := func(k int) []byte {
+			b := batch.Bytes[int(firstBuffer)+16*k:]
+			off := binary.LittleEndian.Uint64(b)
+			assert.Zero(t, off%8)
+			return body[off : off+binary.LittleEndian.Uint64(b[8:])]
+		}
+		for col := range names {
+			node := batch.Bytes[int(firstNode)+16*col:]
+			assert.Equal(t, uint64(length), binary.LittleEndian.Uint64(node))
+			assert.Zero(t, binary.LittleEndian.Uint64(node[8:]), "null count")
+			assert.Empty(t, buffer(3*col))
+			offsets, values := buffer(3*col+1), buffer(3*col+2)
+			for j := 0; j < length; j++ {
+				from := binary.LittleEndian.Uint32(offsets[4*j:])
+				to := binary.LittleEndian.Uint32(offsets[4*j+4:])
+				rows[start+j][col] = string(values[from:to])
+			}
+		}
+	}
+	return names, rows
+}
+
+func TestArrow(t *testing.T) {
+	records := testRecords(batchRows + 5)
+	names, rows := readArrow(t, writeAll(t, "arrow", records))
+	assert.Equal(t, allColumns.Header(), names)
+	assert.Equal(t, len(records), len(rows))
+	for i := range records {
+		assert.Equal(t, allColumns.Row(&records[i]), rows[i])
+	}
+}
+
+func TestArrowEmpty(t *testing.T) {
+	names, rows := readArrow(t, writeAll(t, "arrow", nil))
+	assert.Equal(t, allColumns.Header(), names)
+	assert.Empty(t, rows)
+}
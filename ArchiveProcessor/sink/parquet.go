@@ -0,0 +1,302 @@
+package sink
+
+import (
+	"ArchiveProcessor/fb2"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+)
+
+// A Parquet row group or an Arrow record batch is written every batchRows
+// rows, or sooner once the values take maxBatchBytes. Both formats use 32
+// bit sizes and offsets within a batch.
+const (
+	batchRows     = 1000
+	maxBatchBytes = 64 << 20
+)
+
+// Parquet constants, from parquet.thrift.
+const (
+	parquetByteArray     = 6 // Type
+	parquetRequired      = 0 // FieldRepetitionType
+	parquetUTF8          = 0 // ConvertedType
+	parquetPlain         = 0 // Encoding
+	parquetRLE           = 3 // Encoding
+	parquetGzip          = 2 // CompressionCodec
+	parquetDataPage      = 0 // PageType
+	parquetFormatVersion = 1
+	parquetCreatedBy     = "ArchiveProcessor"
+	parquetMagic         = "PAR1"
+)
+
+type parquetColumnChunk struct {
+	offset                           int64
+	values                           int64
+	uncompressedSize, compressedSize int64
+}
+
+type parquetRowGroup struct {
+	rows    int64
+	columns []parquetColumnChunk
+}
+
+// parquetSink writes a Parquet file with a required string column per
+// header column. Each row group holds one gzip compressed, plain encoded
+// data page per column.
+type parquetSink struct {
+	w         *countingWriter
+	layout    Columns
+	columns   []string
+	batch     [][]string
+	size      int
+	rowGroups []parquetRowGroup
+}
+
+func newParquet(w io.Writer, columns Columns) (Sink, error) {
+	s := &parquetSink{w: &countingWriter{w: w}, layout: columns, columns: columns.Header()}
+	_, err := s.w.Write([]byte(parquetMagic))
+	return s, err
+}
+
+func (s *parquetSink) Write(rec *fb2.Record) error {
+	row := s.layout.Row(rec)
+	s.batch = append(s.batch, row)
+	for _, v := range row {
+		s.size += len(v)
+	}
+	if len(s.batch) >= batchRows || s.size >= maxBatchBytes {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *parquetSink) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	group := parquetRowGroup{rows: int64(len(s.batch))}
+	for col := range s.columns {
+		chunk, err := s.writeColumn(col)
+		if err != nil {
+			return err
+		}
+		group.columns = append(group.columns, chunk)
+	}
+	s.rowGroups = append(s.rowGroups, group)
+	s.batch = s.batch[:0]
+	s.size = 0
+	return nil
+}
+
+func (s *parquetSink) writeColumn(col int) (parquetColumnChunk, error) {
+	// Plain encoded byte arrays: a 4 byte length and the bytes. Required
+	// columns have no repetition or definition levels.
+	var page bytes.Buffer
+	var length [4]byte
+	for _, row := range s.batch {
+		binary.LittleEndian.PutUint32(length[:], uint32(len(row[col])))
+		page.Write(length[:])
+		page.WriteString(row[col])
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(page.Bytes())
+	if err := zw.Close(); err != nil {
+		return parquetColumnChunk{}, err
+	}
+
+	var header thriftWriter
+	header.i32(1, parquetDataPage)
+	header.i32(2, int32(page.Len()))
+	header.i32(3, int32(compressed.Len()))
+	header.structBegin(5)
+	header.i32(1, int32(len(s.batch)))
+	header.i32(2, parquetPlain)
+	header.i32(3, parquetRLE)
+	header.i32(4, parquetRLE)
+	header.structEnd()
+	header.stop()
+
+	chunk := parquetColumnChunk{
+		offset:           s.w.n,
+		values:           int64(len(s.batch)),
+		uncompressedSize: int64(header.buf.Len() + page.Len()),
+		compressedSize:   int64(header.buf.Len() + compressed.Len()),
+	}
+	s.w.Write(header.buf.Bytes())
+	s.w.Write(compressed.Bytes())
+	return chunk, s.w.err
+}
+
+func (s *parquetSink) Close() error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	var numRows int64
+	for _, g := range s.rowGroups {
+		numRows += g.rows
+	}
+
+	var m thriftWriter
+	m.i32(1, parquetFormatVersion)
+	m.listBegin(2, thriftStruct, len(s.columns)+1)
+	m.elemBegin()
+	m.binary(4, "schema")
+	m.i32(5, int32(len(s.columns)))
+	m.elemEnd()
+	for _, name := range s.columns {
+		m.elemBegin()
+		m.i32(1, parquetByteArray)
+		m.i32(3, parquetRequired)
+		m.binary(4, name)
+		m.i32(6, parquetUTF8)
+		m.structBegin(10) // LogicalType
+		m.structBegin(1)  // STRING
+		m.structEnd()
+		m.structEnd()
+		m.elemEnd()
+	}
+	m.i64(3, numRows)
+	m.listBegin(4, thriftStruct, len(s.rowGroups))
+	for _, g := range s.rowGroups {
+		var total, compressed int64
+		m.elemBegin()
+		m.listBegin(1, thriftStruct, len(g.columns))
+		for i, c := range g.columns {
+			m.elemBegin()
+			m.i64(2, c.offset)
+			m.structBegin(3)
+			m.i32(1, parquetByteArray)
+			m.listBegin(2, thriftI32, 2)
+			m.i32Elem(parquetPlain)
+			m.i32Elem(parquetRLE)
+			m.listBegin(3, thriftBinary, 1)
+			m.binaryElem(s.columns[i])
+			m.i32(4, parquetGzip)
+			m.i64(5, c.values)
+			m.i64(6, c.uncompressedSize)
+			m.i64(7, c.compressedSize)
+			m.i64(9, c.offset)
+			m.structEnd()
+			m.elemEnd()
+			total += c.uncompressedSize
+			compressed += c.compressedSize
+		}
+		m.i64(2, total)
+		m.i64(3, g.rows)
+		m.i64(5, g.columns[0].offset)
+		m.i64(6, compressed)
+		m.elemEnd()
+	}
+	m.binary(6, parquetCreatedBy)
+	m.stop()
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(m.buf.Len()))
+	s.w.Write(m.buf.Bytes())
+	s.w.Write(length[:])
+	s.w.Write([]byte(parquetMagic))
+	return s.w.err
+}
+
+// Thrift compact protocol type ids.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the Thrift compact protocol, which Parquet
+// uses for its metadata. Fields must be written in increasing id order.
+type thriftWriter struct {
+	buf    bytes.Buffer
+	lastID int16
+	// stack holds the last field ids of the enclosing structs.
+	stack []int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.lastID; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(zigzag(int64(id)))
+	}
+	t.lastID = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.binaryElem(s)
+}
+
+// structBegin starts a struct field, closed by structEnd.
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.elemBegin()
+}
+
+func (t *thriftWriter) structEnd() {
+	t.elemEnd()
+}
+
+// listBegin starts a list field of n elements. Struct elements are written
+// between elemBegin and elemEnd, others with the *Elem methods.
+func (t *thriftWriter) listBegin(id int16, elemType byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xf0 | elemType)
+		t.varint(uint64(n))
+	}
+}
+
+func (t *thriftWriter) elemBegin() {
+	t.stack = append(t.stack, t.lastID)
+	t.lastID = 0
+}
+
+func (t *thriftWriter) elemEnd() {
+	t.stop()
+	t.lastID = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *thriftWriter) i32Elem(v int32) {
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) binaryElem(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+// stop ends the fields of a struct.
+func (t *thriftWriter) stop() {
+	t.buf.WriteByte(0)
+}
@@ -0,0 +1,146 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// thriftReader decodes the Thrift compact protocol into maps of field ids to
+// values, enough to check the Parquet metadata.
+type thriftReader struct {
+	r *bytes.Reader
+}
+
+func (t *thriftReader) varint() int64 {
+	v, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		panic(err)
+	}
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (t *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case thriftI32, thriftI64:
+		return t.varint()
+	case thriftBinary:
+		v, _ := binary.ReadUvarint(t.r)
+		s := make([]byte, v)
+		io.ReadFull(t.r, s)
+		return string(s)
+	case thriftList:
+		b, _ := t.r.ReadByte()
+		n := int64(b >> 4)
+		if n == 15 {
+			v, _ := binary.ReadUvarint(t.r)
+			n = int64(v)
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = t.value(b & 0xf)
+		}
+		return list
+	case thriftStruct:
+		fields := make(map[int16]interface{})
+		var id int16
+		for {
+			b, _ := t.r.ReadByte()
+			if b == 0 {
+				return fields
+			}
+			if delta := int16(b >> 4); delta != 0 {
+				id += delta
+			} else {
+				id = int16(t.varint())
+			}
+			fields[id] = t.value(b & 0xf)
+		}
+	}
+	panic("unexpected thrift type")
+}
+
+type thriftStructValue = map[int16]interface{}
+
+func readParquet(t *testing.T, data []byte) (thriftStructValue, [][]string) {
+	assert.Equal(t, parquetMagic, string(data[:4]))
+	assert.Equal(t, parquetMagic, string(data[len(data)-4:]))
+	length := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := data[len(data)-8-length : len(data)-8]
+	meta := (&thriftReader{bytes.NewReader(footer)}).value(thriftStruct).(thriftStructValue)
+
+	columns := len(meta[2].([]interface{})) - 1
+	var rows [][]string
+	for _, g := range meta[4].([]interface{}) {
+		group := g.(thriftStructValue)
+		start := len(rows)
+		for i := int64(0); i < group[3].(int64); i++ {
+			rows = append(rows, make([]string, columns))
+		}
+		for col, c := range group[1].([]interface{}) {
+			chunk := c.(thriftStructValue)[3].(thriftStructValue)
+			r := bytes.NewReader(data[chunk[9].(int64):])
+			header := (&thriftReader{r}).value(thriftStruct).(thriftStructValue)
+			assert.Equal(t, int64(parquetDataPage), header[1])
+
+			compressed := make([]byte, header[3].(int64))
+			io.ReadFull(r, compressed)
+			zr, err := gzip.NewReader(bytes.NewReader(compressed))
+			assert.NoError(t, err)
+			page, err := io.ReadAll(zr)
+			assert.NoError(t, err)
+			assert.Equal(t, header[2].(int64), int64(len(page)))
+
+			for i := start; i < len(rows); i++ {
+				n := binary.LittleEndian.Uint32(page)
+				rows[i][col] = string(page[4 : 4+n])
+				page = page[4+n:]
+			}
+			assert.Empty(t, page)
+		}
+	}
+	return meta, rows
+}
+
+func TestParquet(t *testing.T) {
+	records := testRecords(batchRows + 5)
+	meta, rows := readParquet(t, writeAll(t, "parquet", records))
+
+	assert.Equal(t, int64(len(records)), meta[3])
+	assert.Equal(t, 2, len(meta[4].([]interface{})))
+	schema := meta[2].([]interface{})
+	assert.Equal(t, int64(len(allColumns.Header())), schema[0].(thriftStructValue)[5])
+	for i, name := range allColumns.Header() {
+		assert.Equal(t, name, schema[i+1].(thriftStructValue)[4])
+	}
+
+	assert.Equal(t, len(records), len(rows))
+	for i := range records {
+		assert.Equal(t, allColumns.Row(&records[i]), rows[i])
+	}
+}
+
+func TestParquetEmpty(t *testing.T) {
+	meta, rows := readParquet(t, writeAll(t, "parquet", nil))
+	assert.Equal(t, int64(0), meta[3])
+	assert.Empty(t, rows)
+}
+
+func TestThriftFieldIDs(t *testing.T) {
+	// Ids more than 15 apart need the long field header.
+	var w thriftWriter
+	w.i32(1, -3)
+	w.i64(20, 1<<40)
+	w.binary(21, "x")
+	w.stop()
+	v := (&thriftReader{bytes.NewReader(w.buf.Bytes())}).value(thriftStruct)
+	assert.Equal(t, thriftStructValue{1: int64(-3), 20: int64(1 << 40), 21: "x"}, v)
+}
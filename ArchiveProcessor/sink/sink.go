@@ -0,0 +1,162 @@
+// Package sink writes records in the output formats of archive-processor:
+// JSON lines, CSV, Parquet and Arrow IPC. The tabular formats share the
+// columns of Columns.Header.
+package sink
+
+import (
+	"ArchiveProcessor/fb2"
+	"ArchiveProcessor/genre"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Sink writes records. It is not safe for concurrent use.
+type Sink interface {
+	Write(rec *fb2.Record) error
+	// Close writes what is buffered and the trailer of the format, if
+	// any. It does not close the underlying writer.
+	Close() error
+}
+
+// Formats are the names accepted by New.
+var Formats = []string{"jsonl", "csv", "parquet", "arrow"}
+
+// New returns a sink writing format to w, with columns for the tabular
+// formats.
+func New(format string, w io.Writer, columns Columns) (Sink, error) {
+	switch format {
+	case "jsonl":
+		return &jsonLines{w: w}, nil
+	case "csv":
+		return newCSV(w, columns)
+	case "parquet":
+		return newParquet(w, columns)
+	case "arrow":
+		return newArrow(w, columns)
+	}
+	return nil, fmt.Errorf("unknown output format %q, want one of %s", format, strings.Join(Formats, ", "))
+}
+
+// Columns selects the columns of the tabular formats. The zero value gives
+// the columns json2csv has always written, the others follow them.
+type Columns struct {
+	// Genres adds GenreNames and GenreClass.
+	Genres bool
+	// Segments adds Segments, the segments joined with newlines.
+	Segments bool
+}
+
+// Header returns the column names.
+func (c Columns) Header() []string {
+	header := []string{
+		"ID",
+		"Genres",
+		"Authors",
+		"BookTitle",
+		"Body",
+		"Annotation",
+		"FileName",
+	}
+	if c.Genres {
+		header = append(header, "GenreNames", "GenreClass")
+	}
+	if c.Segments {
+		header = append(header, "Segments")
+	}
+	return header
+}
+
+// Row returns the columns of a record.
+func (c Columns) Row(rec *fb2.Record) []string {
+	authors := make([]string, 0, len(rec.Authors))
+	for _, author := range rec.Authors {
+		authors = append(authors, fmt.Sprintf("%s %s", author.FirstName, author.LastName))
+	}
+
+	row := []string{
+		rec.ID,
+		strings.Join(rec.Genres, ";"),
+		strings.Join(authors, ";"),
+		rec.BookTitle,
+		rec.Body,
+		rec.Annotation,
+		rec.FileName,
+	}
+	if c.Genres {
+		row = append(row, strings.Join(genre.Default().Names(rec.Genres), ";"), rec.GenreClass)
+	}
+	if c.Segments {
+		row = append(row, strings.Join(rec.Segments, "\n"))
+	}
+	return row
+}
+
+type jsonLines struct {
+	w io.Writer
+}
+
+// Write writes a record in a single call, so that an interrupted run leaves
+// at most the last line incomplete.
+func (j *jsonLines) Write(rec *fb2.Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(append(data, '\n'))
+	return err
+}
+
+func (j *jsonLines) Close() error { return nil }
+
+type csvSink struct {
+	buf     *bufio.Writer
+	w       *csv.Writer
+	columns Columns
+}
+
+func newCSV(w io.Writer, columns Columns) (Sink, error) {
+	buf := bufio.NewWriter(w)
+	s := &csvSink{buf: buf, w: csv.NewWriter(buf), columns: columns}
+	return s, s.w.Write(columns.Header())
+}
+
+func (s *csvSink) Write(rec *fb2.Record) error {
+	return s.w.Write(s.columns.Row(rec))
+}
+
+func (s *csvSink) Close() error {
+	s.w.Flush()
+	if err := s.w.Error(); err != nil {
+		return err
+	}
+	return s.buf.Flush()
+}
+
+// countingWriter keeps track of the offset in the output, which Parquet and
+// Arrow store in their footers.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+// pad writes zeros up to a multiple of align.
+func (c *countingWriter) pad(align int64) {
+	if rem := c.n % align; rem != 0 {
+		c.Write(make([]byte, align-rem))
+	}
+}
@@ -0,0 +1,83 @@
+package sink
+
+import (
+	"ArchiveProcessor/fb2"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRecords(n int) []fb2.Record {
+	records := make([]fb2.Record, n)
+	for i := range records {
+		records[i] = fb2.Record{
+			ID:         fmt.Sprintf("a.zip/%d.fb2", i),
+			Genres:     []string{"sf", "popadanec"},
+			GenreClass: "sf",
+			Authors:    []fb2.AuthorName{{FirstName: "Иван", LastName: "Иванов"}, {FirstName: "Пётр", LastName: "Петров"}},
+			BookTitle:  fmt.Sprintf("Книга %d", i),
+			Body:       "Первая строка,\n\"вторая\" строка",
+			FileName:   fmt.Sprintf("%d.fb2", i),
+		}
+	}
+	return records
+}
+
+// allColumns are the columns of the tests.
+var allColumns = Columns{Genres: true, Segments: true}
+
+func writeAll(t *testing.T, format string, records []fb2.Record) []byte {
+	var buf bytes.Buffer
+	s, err := New(format, &buf, allColumns)
+	assert.NoError(t, err)
+	for i := range records {
+		assert.NoError(t, s.Write(&records[i]))
+	}
+	assert.NoError(t, s.Close())
+	return buf.Bytes()
+}
+
+func TestRow(t *testing.T) {
+	rec := testRecords(1)[0]
+	rec.Segments = []string{"Первая строка,", "\"вторая\" строка"}
+
+	// The columns json2csv has always written.
+	assert.Equal(t, []string{"ID", "Genres", "Authors", "BookTitle", "Body", "Annotation", "FileName"}, Columns{}.Header())
+	assert.Equal(t, []string{"a.zip/0.fb2", "sf;popadanec", "Иван Иванов;Пётр Петров", "Книга 0", rec.Body, "", "0.fb2"},
+		Columns{}.Row(&rec))
+
+	assert.Equal(t, []string{"ID", "Genres", "Authors", "BookTitle", "Body", "Annotation", "FileName",
+		"GenreNames", "GenreClass", "Segments"}, allColumns.Header())
+	assert.Equal(t, []string{"a.zip/0.fb2", "sf;popadanec", "Иван Иванов;Пётр Петров", "Книга 0", rec.Body, "", "0.fb2",
+		"Научная фантастика;Попаданцы", "sf", rec.Body}, allColumns.Row(&rec))
+	assert.Equal(t, []string{"Segments"}, Columns{Segments: true}.Header()[7:])
+}
+
+func TestJSONLines(t *testing.T) {
+	records := testRecords(3)
+	lines := bytes.Split(writeAll(t, "jsonl", records), []byte("\n"))
+	assert.Equal(t, 4, len(lines))
+	assert.Empty(t, lines[3])
+
+	var rec fb2.Record
+	assert.NoError(t, json.Unmarshal(lines[1], &rec))
+	assert.Equal(t, records[1], rec)
+}
+
+func TestCSV(t *testing.T) {
+	records := testRecords(3)
+	rows, err := csv.NewReader(bytes.NewReader(writeAll(t, "csv", records))).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(rows))
+	assert.Equal(t, allColumns.Header(), rows[0])
+	assert.Equal(t, allColumns.Row(&records[2]), rows[3])
+}
+
+func TestNewUnknown(t *testing.T) {
+	_, err := New("hdf5", &bytes.Buffer{}, Columns{})
+	assert.EqualError(t, err, `unknown output format "hdf5", want one of jsonl, csv, parquet, arrow`)
+}
@@ -0,0 +1,25 @@
+// Package stem is the Snowball stemmer for Russian, the algorithm of the
+// "russian" stemmer of NLTK and Lucene. It removes inflectional endings, so
+// that the forms of a word share a stem: "важная", "важнее" and "важнейшие"
+// all become "важн".
+//
+// The stemmer is github.com/blevesearch/snowballstem, which the Snowball
+// compiler generates from the reference description of the algorithm,
+// rather than github.com/liderman/rustemmer, a port by hand of the same
+// algorithm whose sources were not available when this package was written.
+package stem
+
+import (
+	"strings"
+
+	"github.com/blevesearch/snowballstem"
+	"github.com/blevesearch/snowballstem/russian"
+)
+
+// Russian returns the stem of a lower-case Russian word. ё is read as е, as
+// the current Snowball algorithm does and the generated stemmer does not.
+func Russian(word string) string {
+	env := snowballstem.NewEnv(strings.ReplaceAll(word, "ё", "е"))
+	russian.Stem(env)
+	return env.Current()
+}
@@ -0,0 +1,61 @@
+package stem
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRussian(t *testing.T) {
+	// Each step of the algorithm, and ё.
+	for word, want := range map[string]string{
+		"в":             "в",
+		"вавиловка":     "вавиловк",
+		"вагоне":        "вагон",
+		"вагонов":       "вагон",
+		"важная":        "важн",
+		"важнее":        "важн",
+		"важнейшие":     "важн",
+		"важнейшими":    "важн",
+		"важничал":      "важнича",
+		"важного":       "важн",
+		"вазах":         "ваз",
+		"валандался":    "валанда",
+		"валерьяныч":    "валерьяныч",
+		"валился":       "вал",
+		"валится":       "вал",
+		"вальдшнепа":    "вальдшнеп",
+		"вами":          "вам",
+		"бегущий":       "бегущ",
+		"быстрейший":    "быстр",
+		"авиационной":   "авиацион",
+		"аберрации":     "аберрац",
+		"августа":       "август",
+		"авдотьей":      "авдот",
+		"благородность": "благородн",
+		"прочитавшись":  "прочита",
+		"длинный":       "длин",
+		"ёлки":          "елк",
+	} {
+		assert.Equal(t, want, Russian(word), word)
+	}
+}
+
+// TestVocabulary stems testdata/voc.txt, a word per line as in the Snowball
+// test data, and compares the stems with testdata/output.txt. See
+// testdata/README.md for where they come from.
+func TestVocabulary(t *testing.T) {
+	voc, err := os.ReadFile("testdata/voc.txt")
+	assert.NoError(t, err)
+	output, err := os.ReadFile("testdata/output.txt")
+	assert.NoError(t, err)
+
+	words := strings.Fields(string(voc))
+	stems := strings.Fields(string(output))
+	assert.Equal(t, len(words), len(stems))
+	for i := 0; i < min(len(words), len(stems)); i++ {
+		assert.Equal(t, stems[i], Russian(words[i]), words[i])
+	}
+}
@@ -0,0 +1,151 @@
+// Command tfidf turns the bodies of the records written by archive-processor
+// into a sparse TF-IDF matrix, a row per book, for classical baselines such as
+// logistic regression. Next to the matrix it writes <output>.ids.txt, the book
+// IDs of the rows, <output>.vocab.txt, the terms of the columns, and
+// <output>.classes.txt, the genre classes numbered by the SVMlight labels.
+package main
+
+import (
+	"ArchiveProcessor/bow"
+	"ArchiveProcessor/fb2"
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// export is a run of the command, set by the flags.
+type export struct {
+	input       string
+	output      string
+	format      string
+	stemming    bool
+	sublinearTF bool
+	cutoffs     bow.Cutoffs
+}
+
+// forEachRecord calls fn with the records of a JSON lines file.
+func forEachRecord(path string, fn func(rec *fb2.Record)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var rec fb2.Record
+		if err := decoder.Decode(&rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fn(&rec)
+	}
+}
+
+func writeLines(path string, lines []string) error {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func main() {
+	var e export
+	flag.StringVar(&e.input, "input", "", "JSON lines file written by archive-processor")
+	flag.StringVar(&e.output, "output", "", "Output matrix path")
+	flag.StringVar(&e.format, "format", "svmlight", "Matrix format: "+strings.Join(bow.MatrixFormats, ", "))
+	flag.BoolVar(&e.stemming, "stem", true, "Replace Russian words by their stems")
+	flag.BoolVar(&e.sublinearTF, "sublinear_tf", false, "Count a term found n times as 1+ln(n)")
+	flag.IntVar(&e.cutoffs.MinDF, "min_df", 2, "Number of books a term must be found in")
+	flag.Float64Var(&e.cutoffs.MaxDF, "max_df", 0.9, "Largest fraction of the books a term may be found in")
+	flag.IntVar(&e.cutoffs.MaxFeatures, "max_features", 0, "Keep only this many of the most frequent terms, 0 for all")
+	flag.Parse()
+
+	if e.input == "" || e.output == "" {
+		log.Fatal("-input and -output are required")
+	}
+	if !slices.Contains(bow.MatrixFormats, e.format) {
+		log.Fatalf("Unknown matrix format %q, want one of %s", e.format, strings.Join(bow.MatrixFormats, ", "))
+	}
+	if err := e.cutoffs.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := e.run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run writes the matrix and the files next to it.
+func (e export) run() error {
+	// The first pass counts the books each term is found in, the second
+	// writes the rows, so that the books need not be kept in memory.
+	counter := bow.NewCounter()
+	var ids []string
+	classSet := make(map[string]bool)
+	err := forEachRecord(e.input, func(rec *fb2.Record) {
+		counter.Add(bow.Terms(rec.Body, e.stemming))
+		ids = append(ids, rec.ID)
+		classSet[rec.GenreClass] = true
+	})
+	if err != nil {
+		return err
+	}
+
+	vocab := counter.Vocabulary(e.cutoffs)
+	log.Printf("%d books, %d of %d terms kept", counter.Docs, len(vocab.Terms), len(counter.DF))
+
+	classes := make([]string, 0, len(classSet))
+	for class := range classSet {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	labels := make(map[string]int, len(classes))
+	for i, class := range classes {
+		labels[class] = i
+	}
+
+	f, err := os.Create(e.output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	matrix, err := bow.NewMatrixWriter(e.format, f, len(vocab.Terms))
+	if err != nil {
+		return err
+	}
+	var writeErr error
+	err = forEachRecord(e.input, func(rec *fb2.Record) {
+		if writeErr == nil {
+			writeErr = matrix.WriteRow(labels[rec.GenreClass], vocab.TFIDF(bow.Terms(rec.Body, e.stemming), e.sublinearTF))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	if err := matrix.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	for suffix, lines := range map[string][]string{".ids.txt": ids, ".vocab.txt": vocab.Terms, ".classes.txt": classes} {
+		if err := writeLines(e.output+suffix, lines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"ArchiveProcessor/bow"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// books has document frequencies кот 4, и 4, пес 2, дом 2 and сад 1.
+const books = `{"id":"11","genre_class":"prose","body":"Кот, пёс и дом."}
+{"id":"12","genre_class":"poetry","body":"Кот и дом, дом."}
+{"id":"13","genre_class":"prose","body":"Кот и сад."}
+{"id":"14","genre_class":"detective","body":"Кот и пёс."}
+`
+
+// runExport exports books and returns the lines of the matrix, ids, vocab
+// and classes files.
+func runExport(t *testing.T, format string, cutoffs bow.Cutoffs) (matrix, ids, vocab, classes []string) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "books.jsonl")
+	assert.NoError(t, os.WriteFile(input, []byte(books), 0644))
+	e := export{input: input, output: filepath.Join(dir, "matrix"), format: format, cutoffs: cutoffs}
+	assert.NoError(t, e.run())
+
+	lines := func(suffix string) []string {
+		data, err := os.ReadFile(e.output + suffix)
+		assert.NoError(t, err)
+		if len(data) == 0 {
+			return nil
+		}
+		return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	return lines(""), lines(".ids.txt"), lines(".vocab.txt"), lines(".classes.txt")
+}
+
+func TestMatrixMarket(t *testing.T) {
+	matrix, ids, vocab, classes := runExport(t, "mm", bow.Cutoffs{MinDF: 2, MaxDF: 0.9})
+
+	// Rows follow the ids, columns the vocabulary. Book 13 has none of the
+	// terms, and so no entries.
+	assert.Equal(t, []string{"11", "12", "13", "14"}, ids)
+	assert.Equal(t, []string{"дом", "пес"}, vocab)
+	assert.Equal(t, []string{"detective", "poetry", "prose"}, classes)
+	assert.Equal(t, []string{
+		"%%MatrixMarket matrix coordinate real general",
+		"4 2 4",
+		"1 1 0.707107",
+		"1 2 0.707107",
+		"2 1 1",
+		"4 2 1",
+	}, append([]string{matrix[0], strings.TrimSpace(matrix[1])}, matrix[2:]...))
+}
+
+func TestSVMLightLabels(t *testing.T) {
+	matrix, _, vocab, classes := runExport(t, "svmlight", bow.Cutoffs{MinDF: 2, MaxDF: 0.9})
+	assert.Equal(t, []string{"дом", "пес"}, vocab)
+
+	// Labels are lines of the classes file, counted from 0.
+	assert.Equal(t, []string{"2 1:0.707107 2:0.707107", "1 1:1", "2", "0 2:1"}, matrix)
+	assert.Equal(t, "prose", classes[2])
+}
+
+func TestCutoffs(t *testing.T) {
+	// min_df counts books, max_df is a fraction of them: 1 keeps the terms
+	// of every book, 0 sets no limit.
+	for _, c := range []struct {
+		cutoffs bow.Cutoffs
+		vocab   []string
+	}{
+		{bow.Cutoffs{MinDF: 1, MaxDF: 0.9}, []string{"дом", "пес", "сад"}},
+		{bow.Cutoffs{MinDF: 2, MaxDF: 1}, []string{"дом", "и", "кот", "пес"}},
+		{bow.Cutoffs{MinDF: 3}, []string{"и", "кот"}},
+		{bow.Cutoffs{MinDF: 2, MaxDF: 0.5}, []string{"дом", "пес"}},
+		{bow.Cutoffs{MinDF: 2, MaxDF: 0.4}, nil},
+	} {
+		_, _, vocab, _ := runExport(t, "mm", c.cutoffs)
+		assert.Equal(t, c.vocab, vocab, "%+v", c.cutoffs)
+	}
+}
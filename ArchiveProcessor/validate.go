@@ -0,0 +1,222 @@
+package main
+
+import (
+	"ArchiveProcessor/schema"
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+
+	pb "github.com/schollz/progressbar/v3"
+)
+
+// maxReportedViolations caps the violations written per book.
+const maxReportedViolations = 100
+
+// BookValidity is the validate mode record of a single book.
+type BookValidity struct {
+	ID         string             `json:"id"`
+	Valid      bool               `json:"valid"`
+	Violations []schema.Violation `json:"violations,omitempty"`
+	// Total is the number of violations before capping.
+	Total int `json:"total,omitempty"`
+}
+
+// ValidationStats counts validation results. Errors counts the books that
+// couldn't be validated, which are not in Total.
+type ValidationStats struct {
+	Total     int
+	Valid     int
+	Invalid   int
+	Malformed int
+	Errors    int
+	ByKind    map[schema.Kind]int
+	ByMessage map[string]int
+}
+
+func newValidationStats() *ValidationStats {
+	return &ValidationStats{
+		ByKind:    make(map[schema.Kind]int),
+		ByMessage: make(map[string]int),
+	}
+}
+
+func (s *ValidationStats) add(v BookValidity) {
+	s.Total++
+	if v.Valid {
+		s.Valid++
+		return
+	}
+	s.Invalid++
+
+	// Books are counted once per kind and message, not once per violation.
+	kinds := make(map[schema.Kind]bool)
+	messages := make(map[string]bool)
+	for _, violation := range v.Violations {
+		if violation.Kind == schema.NotWellFormed {
+			s.Malformed++
+		}
+		kinds[violation.Kind] = true
+		messages[violation.Message] = true
+	}
+	for k := range kinds {
+		s.ByKind[k]++
+	}
+	for m := range messages {
+		s.ByMessage[m]++
+	}
+}
+
+func (s *ValidationStats) merge(other *ValidationStats) {
+	s.Total += other.Total
+	s.Valid += other.Valid
+	s.Invalid += other.Invalid
+	s.Malformed += other.Malformed
+	s.Errors += other.Errors
+	for k, n := range other.ByKind {
+		s.ByKind[k] += n
+	}
+	for m, n := range other.ByMessage {
+		s.ByMessage[m] += n
+	}
+}
+
+// Print writes the counts and the most common messages to w.
+func (s *ValidationStats) Print(w io.Writer, name string, topMessages int) {
+	fmt.Fprintf(w, "%s: %d books, %d valid, %d invalid, %d not well-formed, %d errors\n",
+		name, s.Total, s.Valid, s.Invalid, s.Malformed, s.Errors)
+
+	kinds := make([]string, 0, len(s.ByKind))
+	for k := range s.ByKind {
+		kinds = append(kinds, string(k))
+	}
+	sort.Strings(kinds)
+	for _, k := range kinds {
+		fmt.Fprintf(w, "  %-20s %d\n", k, s.ByKind[schema.Kind(k)])
+	}
+
+	messages := make([]string, 0, len(s.ByMessage))
+	for m := range s.ByMessage {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if s.ByMessage[messages[i]] != s.ByMessage[messages[j]] {
+			return s.ByMessage[messages[i]] > s.ByMessage[messages[j]]
+		}
+		return messages[i] < messages[j]
+	})
+	if len(messages) > topMessages {
+		messages = messages[:topMessages]
+	}
+	for _, m := range messages {
+		fmt.Fprintf(w, "  %6d  %s\n", s.ByMessage[m], m)
+	}
+}
+
+// ValidateBook checks a zipped book against the FB2 schema.
+func ValidateBook(fb2File *zip.File) (BookValidity, error) {
+	v := BookValidity{ID: fb2File.Name}
+
+	reader, err := fb2File.Open()
+	if err != nil {
+		return v, fmt.Errorf("error opening file %s because %+v", fb2File.Name, err)
+	}
+	defer reader.Close()
+
+	violations, err := schema.FictionBook().Validate(reader)
+	if err != nil {
+		return v, err
+	}
+
+	v.Valid = len(violations) == 0
+	v.Total = len(violations)
+	if len(violations) > maxReportedViolations {
+		violations = violations[:maxReportedViolations]
+	}
+	v.Violations = violations
+	return v, nil
+}
+
+// ValidateArchives validates every book in zipFiles, writes a BookValidity
+// line per book to out and prints per-archive and overall stats to stdout.
+// Archives that can't be opened and books that can't be validated are logged
+// and skipped; only a failure to write out stops it.
+func ValidateArchives(zipFiles []string, out io.Writer) (*ValidationStats, error) {
+	const maxGoroutines = 8
+	goroutineSem := make(chan struct{}, maxGoroutines)
+
+	overall := newValidationStats()
+	for n, file := range zipFiles {
+		r, err := zip.OpenReader(file)
+		if err != nil {
+			log.Printf("Error opening archive %s: %+v\n", file, err)
+			continue
+		}
+
+		fmt.Printf("Validating file %d/%d: %s\n", n+1, len(zipFiles), file)
+		bar := pb.New(len(r.File))
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var writeErr error
+		stats := newValidationStats()
+		for _, fb2File := range r.File {
+			goroutineSem <- struct{}{}
+			wg.Add(1)
+
+			go func(fb2File *zip.File) {
+				defer wg.Done()
+				defer func() { <-goroutineSem }()
+
+				v, err := ValidateBook(fb2File)
+				if err != nil {
+					log.Printf("Error validating book %s/%s: %+v\n", file, fb2File.Name, err)
+					mu.Lock()
+					defer mu.Unlock()
+					stats.Errors++
+					bar.Add(1)
+					return
+				}
+				v.ID = fmt.Sprintf("%s/%s", file, v.ID)
+				jsdata, err := json.Marshal(v)
+				if err != nil {
+					log.Printf("Error marshalling data %+v\n", err)
+					return
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if writeErr != nil {
+					return
+				}
+				if _, err := out.Write(append(jsdata, '\n')); err != nil {
+					writeErr = fmt.Errorf("error writing validation results: %w", err)
+					return
+				}
+				stats.add(v)
+				bar.Add(1)
+			}(fb2File)
+		}
+		wg.Wait()
+		if writeErr != nil {
+			r.Close()
+			return nil, writeErr
+		}
+
+		bar.Finish()
+		r.Close()
+
+		fmt.Println()
+		stats.Print(log.Writer(), file, 10)
+		stats.Print(os.Stdout, file, 10)
+		overall.merge(stats)
+	}
+
+	overall.Print(log.Writer(), "total", 20)
+	overall.Print(os.Stdout, "total", 20)
+	return overall, nil
+}
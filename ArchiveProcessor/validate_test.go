@@ -0,0 +1,42 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateArchivesContinues(t *testing.T) {
+	dir := t.TempDir()
+	book, err := os.ReadFile("fb2/testdata/177692.fb2")
+	assert.NoError(t, err)
+
+	// One book reads back fine, the other fails its checksum.
+	archive := filepath.Join(dir, "a.zip")
+	f, err := os.Create(archive)
+	assert.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for name, crc := range map[string]uint32{"good.fb2": crc32.ChecksumIEEE(book), "bad.fb2": 1} {
+		w, err := zw.CreateRaw(&zip.FileHeader{Name: name, Method: zip.Store, CRC32: crc,
+			CompressedSize64: uint64(len(book)), UncompressedSize64: uint64(len(book))})
+		assert.NoError(t, err)
+		_, err = w.Write(book)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	assert.NoError(t, f.Close())
+
+	var out bytes.Buffer
+	stats, err := ValidateArchives([]string{filepath.Join(dir, "missing.zip"), archive}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.Total)
+	assert.Equal(t, 1, stats.Errors)
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+	assert.Contains(t, out.String(), `"id":"`+archive+`/good.fb2"`)
+}
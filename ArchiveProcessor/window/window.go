@@ -0,0 +1,262 @@
+// Package window takes windows of text out of a book, so that what is kept of
+// a long book need not be its title page. Windows are counted in runes, words
+// or sentences and never split a rune.
+package window
+
+import (
+	"ArchiveProcessor/segment"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Unit is what the size of a window is counted in.
+type Unit string
+
+const (
+	Runes     Unit = "runes"
+	Words     Unit = "words"
+	Sentences Unit = "sentences"
+)
+
+// Strategy says where the windows are taken from.
+type Strategy string
+
+const (
+	// Head takes the start of the text.
+	Head Strategy = "head"
+	// SkipFront takes the start of the text after the front matter, such as
+	// the title, dedication and epigraphs, see FrontMatterEnd.
+	SkipFront Strategy = "skip_front"
+	// Spaced takes Count windows evenly spaced over the text, the first at
+	// its start and the last at its end.
+	Spaced Strategy = "spaced"
+	// Random takes Count windows at positions that depend only on the seed
+	// and the key of the book.
+	Random Strategy = "random"
+)
+
+// Units and Strategies are the accepted names.
+var (
+	Units      = []Unit{Runes, Words, Sentences}
+	Strategies = []Strategy{Head, SkipFront, Spaced, Random}
+)
+
+// Separator joins windows into one text. Windows never hold it, so that the
+// text can be split back into them.
+const Separator = "\n\n"
+
+// maxFrontRunes bounds the search for the end of the front matter.
+const maxFrontRunes = 3000
+
+// Config describes the windows taken from a text.
+type Config struct {
+	Strategy Strategy `json:"strategy"`
+	Unit     Unit     `json:"unit"`
+	// Size is the length of a window in units, before the whitespace at
+	// its ends is trimmed.
+	Size int `json:"size"`
+	// Count is the number of windows of Spaced and Random, 1 if unset.
+	// Shorter texts get fewer windows, as windows do not overlap.
+	Count int    `json:"count,omitempty"`
+	Seed  uint64 `json:"seed,omitempty"`
+}
+
+// Validate checks the names and sizes of the config.
+func (c Config) Validate() error {
+	if !slices.Contains(Strategies, c.Strategy) {
+		return fmt.Errorf("unknown window strategy %q", c.Strategy)
+	}
+	if !slices.Contains(Units, c.Unit) {
+		return fmt.Errorf("unknown window unit %q", c.Unit)
+	}
+	if c.Size < 1 {
+		return fmt.Errorf("window size %d is not positive", c.Size)
+	}
+	if c.Count < 0 {
+		return fmt.Errorf("window count %d is negative", c.Count)
+	}
+	return nil
+}
+
+// MaxRunes returns how many runes from the start of the text Windows looks
+// at, or 0 if it may need all of it.
+func (c Config) MaxRunes() int {
+	switch {
+	case c.Unit != Runes:
+		return 0
+	case c.Strategy == Head:
+		return c.Size
+	case c.Strategy == SkipFront:
+		return maxFrontRunes + c.Size
+	}
+	return 0
+}
+
+// Windows returns the windows of text in text order, with surrounding
+// whitespace and blank lines removed. key identifies the book for Random.
+func (c Config) Windows(text, key string) []string {
+	text = strings.TrimSpace(text)
+	if c.Strategy == SkipFront {
+		text = text[FrontMatterEnd(text):]
+	}
+	// Runes are counted rather than split into spans, which would take a
+	// span per rune of the book for a few windows.
+	var spans []span
+	n := utf8.RuneCountInString(text)
+	if c.Unit != Runes {
+		spans = split(text, c.Unit)
+		n = len(spans)
+	}
+	if n == 0 {
+		return nil
+	}
+	size := min(c.Size, n)
+
+	count := max(c.Count, 1)
+	if c.Strategy == Head || c.Strategy == SkipFront {
+		count = 1
+	}
+	count = min(count, n/size)
+
+	starts := make([]int, count)
+	switch c.Strategy {
+	case Spaced:
+		for k := 1; k < count; k++ {
+			starts[k] = k * (n - size) / (count - 1)
+		}
+	case Random:
+		// Uniform over the ways to place count windows without overlap:
+		// the gaps between them are drawn, then the windows laid out.
+		rng := rand.New(rand.NewSource(int64(seedFor(key, c.Seed))))
+		free := n - count*size
+		for k := range starts {
+			starts[k] = rng.Intn(free + 1)
+		}
+		sort.Ints(starts)
+		for k := range starts {
+			starts[k] += k * size
+		}
+	}
+
+	bounds := make([]span, count)
+	if c.Unit == Runes {
+		positions := make([]int, 0, 2*count)
+		for _, start := range starts {
+			positions = append(positions, start, start+size)
+		}
+		offsets := runeOffsets(text, positions)
+		for k := range bounds {
+			bounds[k] = span{offsets[2*k], offsets[2*k+1]}
+		}
+	} else {
+		for k, start := range starts {
+			bounds[k] = span{spans[start].start, spans[start+size-1].end}
+		}
+	}
+
+	windows := make([]string, 0, count)
+	for _, b := range bounds {
+		w := strings.TrimSpace(text[b.start:b.end])
+		for strings.Contains(w, Separator) {
+			w = strings.ReplaceAll(w, Separator, "\n")
+		}
+		if w != "" {
+			windows = append(windows, w)
+		}
+	}
+	return windows
+}
+
+// runeOffsets returns the byte offsets in text of the runes at positions,
+// which are ascending, in a single pass over text. A position past the last
+// rune is at len(text).
+func runeOffsets(text string, positions []int) []int {
+	offsets := make([]int, len(positions))
+	i, r := 0, 0
+	for k, pos := range positions {
+		for ; r < pos && i < len(text); r++ {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			i += size
+		}
+		offsets[k] = i
+	}
+	return offsets
+}
+
+func seedFor(key string, seed uint64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64() ^ seed
+}
+
+type span struct {
+	start, end int
+}
+
+// split returns the byte spans of the words or sentences of text.
+func split(text string, unit Unit) []span {
+	var spans []span
+	switch unit {
+	case Words:
+		start := -1
+		for i, r := range text {
+			if !unicode.IsSpace(r) {
+				if start < 0 {
+					start = i
+				}
+				continue
+			}
+			if start >= 0 {
+				spans = append(spans, span{start, i})
+				start = -1
+			}
+		}
+		if start >= 0 {
+			spans = append(spans, span{start, len(text)})
+		}
+	case Sentences:
+		// The sentences are substrings of text, in order.
+		pos := 0
+		for _, s := range segment.Sentences(text) {
+			i := pos + strings.Index(text[pos:], s)
+			spans = append(spans, span{i, i + len(s)})
+			pos = i + len(s)
+		}
+	}
+	return spans
+}
+
+// FrontMatterEnd returns the offset of the first paragraph of text, one per
+// line, that looks like prose: at least 40 runes ending a sentence and not
+// in capitals. Only the first maxFrontRunes runes are searched, 0 is returned
+// if there is no such paragraph there.
+func FrontMatterEnd(text string) int {
+	pos := 0
+	runes := 0
+	for pos < len(text) && runes < maxFrontRunes {
+		line := text[pos:]
+		if i := strings.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i+1]
+		}
+		if isProse(strings.TrimSpace(line)) {
+			return pos
+		}
+		pos += len(line)
+		runes += utf8.RuneCountInString(line)
+	}
+	return 0
+}
+
+func isProse(paragraph string) bool {
+	if utf8.RuneCountInString(paragraph) < 40 || strings.ToUpper(paragraph) == paragraph {
+		return false
+	}
+	last, _ := utf8.DecodeLastRuneInString(strings.TrimRight(paragraph, `»"”’')`))
+	return strings.ContainsRune(".!?…", last)
+}
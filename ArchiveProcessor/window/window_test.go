@@ -0,0 +1,112 @@
+package window
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowsHead(t *testing.T) {
+	c := Config{Strategy: Head, Unit: Runes, Size: 5}
+	assert.Equal(t, []string{"Съешь"}, c.Windows("  Съешь же ещё", ""))
+	assert.Equal(t, []string{"ёж"}, c.Windows("ёж", ""))
+	assert.Nil(t, c.Windows(" \n ", ""))
+
+	// Never half a rune, which cutting the bytes would leave here.
+	for size := 1; size < 20; size++ {
+		c.Size = size
+		for _, w := range c.Windows("Жёлтый ёжик", "") {
+			assert.True(t, utf8.ValidString(w))
+		}
+	}
+
+	c = Config{Strategy: Head, Unit: Words, Size: 3}
+	assert.Equal(t, []string{"Съешь же\nещё"}, c.Windows("Съешь же\nещё этих булок", ""))
+
+	c = Config{Strategy: Head, Unit: Sentences, Size: 2}
+	assert.Equal(t, []string{"Раз. Два!"}, c.Windows("Раз. Два! Три?", ""))
+}
+
+func TestWindowsSkipFront(t *testing.T) {
+	text := "ЧАСТЬ ПЕРВАЯ\nПосвящается моей жене\nОн вышел из дома рано утром и долго шёл вдоль реки.\nПотом вернулся."
+	assert.Equal(t, strings.Index(text, "Он"), FrontMatterEnd(text))
+	c := Config{Strategy: SkipFront, Unit: Words, Size: 3}
+	assert.Equal(t, []string{"Он вышел из"}, c.Windows(text, ""))
+
+	// Without prose the text is taken from its start.
+	assert.Equal(t, 0, FrontMatterEnd("Стихи\nКороткая строка."))
+}
+
+func numbers(n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprint(i)
+	}
+	return strings.Join(words, " ")
+}
+
+func TestWindowsSpaced(t *testing.T) {
+	c := Config{Strategy: Spaced, Unit: Words, Size: 2, Count: 3}
+	assert.Equal(t, []string{"0 1", "4 5", "8 9"}, c.Windows(numbers(10), ""))
+	// Fewer windows when they would overlap.
+	assert.Equal(t, []string{"0 1", "3 4"}, c.Windows(numbers(5), ""))
+	assert.Equal(t, []string{"0"}, c.Windows(numbers(1), ""))
+}
+
+func TestWindowsSeparator(t *testing.T) {
+	// Blank lines are removed, so that the joined windows split back.
+	c := Config{Strategy: Spaced, Unit: Words, Size: 3, Count: 2}
+	windows := c.Windows("a\n\nb\n\n\nc d\n\ne f", "")
+	assert.Equal(t, []string{"a\nb\nc", "d\ne f"}, windows)
+	assert.Equal(t, windows, strings.Split(strings.Join(windows, Separator), Separator))
+}
+
+func TestWindowsSpacedRunes(t *testing.T) {
+	c := Config{Strategy: Spaced, Unit: Runes, Size: 2, Count: 3}
+	assert.Equal(t, []string{"ёж", "ик", "ёл"}, c.Windows("ёжикиёл", ""))
+	c.Strategy = Random
+	for _, w := range c.Windows(strings.Repeat("жё", 50), "a.zip/1.fb2") {
+		assert.True(t, utf8.ValidString(w))
+		assert.Equal(t, 2, utf8.RuneCountInString(w))
+	}
+}
+
+func TestRuneOffsets(t *testing.T) {
+	assert.Equal(t, []int{0, 2, 3, 5, 5}, runeOffsets("жaё", []int{0, 1, 2, 3, 9}))
+	assert.Equal(t, []int{0, 0}, runeOffsets("", []int{0, 1}))
+}
+
+func TestWindowsRandom(t *testing.T) {
+	c := Config{Strategy: Random, Unit: Words, Size: 3, Count: 4, Seed: 7}
+	text := numbers(100)
+	windows := c.Windows(text, "a.zip/1.fb2")
+	assert.Len(t, windows, 4)
+	assert.Equal(t, windows, c.Windows(text, "a.zip/1.fb2"))
+	assert.NotEqual(t, windows, c.Windows(text, "a.zip/2.fb2"))
+
+	last := -1
+	for _, w := range windows {
+		var a, b, d int
+		_, err := fmt.Sscan(w, &a, &b, &d)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{a + 1, a + 2}, []int{b, d})
+		assert.Greater(t, a, last, "in order and without overlap")
+		last = d
+	}
+
+	c.Seed = 8
+	assert.NotEqual(t, windows, c.Windows(text, "a.zip/1.fb2"))
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, Config{Strategy: Head, Unit: Runes, Size: 1}.Validate())
+	assert.Error(t, Config{Strategy: "tail", Unit: Runes, Size: 1}.Validate())
+	assert.Error(t, Config{Strategy: Head, Unit: "bytes", Size: 1}.Validate())
+	assert.Error(t, Config{Strategy: Head, Unit: Runes}.Validate())
+	assert.Equal(t, 10, Config{Strategy: Head, Unit: Runes, Size: 10}.MaxRunes())
+	assert.Zero(t, Config{Strategy: Spaced, Unit: Runes, Size: 10}.MaxRunes())
+	assert.Zero(t, Config{Strategy: Head, Unit: Words, Size: 10}.MaxRunes())
+}
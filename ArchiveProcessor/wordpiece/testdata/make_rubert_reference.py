@@ -0,0 +1,34 @@
+"""Writes the reference outputs of the rubert-base-cased tokenizer for the
+parity test in wordpiece_test.go.
+
+    pip install transformers
+    python make_rubert_reference.py texts.txt
+
+It saves the vocabulary to rubert/vocab.txt and, for every line of the
+texts file, the tokens and the ids at MAX_TOKENS to rubert/reference.jsonl.
+"""
+import json
+import os
+import sys
+
+from transformers import AutoTokenizer
+
+MODEL_NAME = 'DeepPavlov/rubert-base-cased'
+MAX_TOKENS = 128
+
+tokenizer = AutoTokenizer.from_pretrained(MODEL_NAME)
+os.makedirs('rubert', exist_ok=True)
+tokenizer.save_vocabulary('rubert')
+
+with open(sys.argv[1], encoding='utf-8') as texts, \
+        open('rubert/reference.jsonl', 'w', encoding='utf-8') as out:
+    for text in texts:
+        text = text.rstrip('\n')
+        encoded = tokenizer.encode_plus(text, add_special_tokens=True, max_length=MAX_TOKENS,
+                                        truncation=True, padding='max_length')
+        out.write(json.dumps({
+            'text': text,
+            'tokens': tokenizer.tokenize(text),
+            'input_ids': encoded['input_ids'],
+            'attention_mask': encoded['attention_mask'],
+        }, ensure_ascii=False) + '\n')
@@ -0,0 +1,289 @@
+// Package wordpiece is a BERT tokenizer: the basic tokenization, which
+// cleans the text and splits it on whitespace and punctuation, followed by
+// WordPiece, which splits words into the longest pieces in the vocabulary.
+// It follows the fast HuggingFace BertTokenizer, as returned by
+// AutoTokenizer, so that the ids match those the models were trained on.
+package wordpiece
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Special tokens of BERT vocabularies.
+const (
+	Unknown = "[UNK]"
+	Class   = "[CLS]"
+	Sep     = "[SEP]"
+	Pad     = "[PAD]"
+)
+
+// maxWordRunes is the length of the longest word split into pieces, longer
+// ones become Unknown.
+const maxWordRunes = 100
+
+// Vocab maps tokens to ids.
+type Vocab struct {
+	ids    map[string]int
+	tokens []string
+}
+
+// ReadVocab reads a vocab.txt file: a token per line, the id of a token is its
+// line number from 0. A token listed twice has the id of its last line, as
+// in HuggingFace.
+func ReadVocab(r io.Reader) (*Vocab, error) {
+	v := &Vocab{ids: make(map[string]int)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		token := strings.TrimSuffix(scanner.Text(), "\r")
+		v.ids[token] = len(v.tokens)
+		v.tokens = append(v.tokens, token)
+	}
+	return v, scanner.Err()
+}
+
+// LoadVocab reads the vocab.txt file at path.
+func LoadVocab(path string) (*Vocab, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadVocab(f)
+}
+
+// ID returns the id of a token.
+func (v *Vocab) ID(token string) (int, bool) {
+	id, ok := v.ids[token]
+	return id, ok
+}
+
+// Token returns the token of an id.
+func (v *Vocab) Token(id int) string {
+	return v.tokens[id]
+}
+
+// Len returns the number of tokens.
+func (v *Vocab) Len() int {
+	return len(v.tokens)
+}
+
+// Options are the settings of the basic tokenization. Cased models such as
+// rubert-base-cased use neither, uncased ones both.
+type Options struct {
+	Lowercase bool
+	// StripAccents removes combining marks after decomposing the text, so
+	// that "й" becomes "и".
+	StripAccents bool
+}
+
+// Tokenizer turns text into the ids of a vocabulary.
+type Tokenizer struct {
+	vocab              *Vocab
+	opts               Options
+	unk, cls, sep, pad int
+}
+
+// New returns a tokenizer for vocab, which must hold the special tokens.
+func New(vocab *Vocab, opts Options) (*Tokenizer, error) {
+	t := &Tokenizer{vocab: vocab, opts: opts}
+	for token, id := range map[string]*int{Unknown: &t.unk, Class: &t.cls, Sep: &t.sep, Pad: &t.pad} {
+		var ok bool
+		if *id, ok = vocab.ID(token); !ok {
+			return nil, fmt.Errorf("vocabulary has no %s token", token)
+		}
+	}
+	return t, nil
+}
+
+// Load returns a tokenizer for the vocab.txt file at path.
+func Load(path string, opts Options) (*Tokenizer, error) {
+	vocab, err := LoadVocab(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := New(vocab, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Vocab returns the vocabulary of the tokenizer.
+func (t *Tokenizer) Vocab() *Vocab {
+	return t.vocab
+}
+
+// Tokenize returns the tokens of text, without special tokens.
+func (t *Tokenizer) Tokenize(text string) []string {
+	var tokens []string
+	for _, word := range BasicTokenize(text, t.opts) {
+		tokens = append(tokens, t.WordPiece(word)...)
+	}
+	return tokens
+}
+
+// WordPiece splits a word into the longest pieces found in the vocabulary,
+// the pieces after the first prefixed with "##". A word that can't be split
+// is Unknown.
+func (t *Tokenizer) WordPiece(word string) []string {
+	if utf8.RuneCountInString(word) > maxWordRunes {
+		return []string{Unknown}
+	}
+
+	var pieces []string
+	for start := 0; start < len(word); {
+		end := len(word)
+		piece := ""
+		for end > start {
+			piece = word[start:end]
+			if start > 0 {
+				piece = "##" + piece
+			}
+			if _, ok := t.vocab.ID(piece); ok {
+				break
+			}
+			_, size := utf8.DecodeLastRuneInString(word[start:end])
+			end -= size
+		}
+		if end == start {
+			return []string{Unknown}
+		}
+		pieces = append(pieces, piece)
+		start = end
+	}
+	return pieces
+}
+
+// Encoding is the input of a BERT model for a text.
+type Encoding struct {
+	InputIDs      []int `json:"input_ids"`
+	AttentionMask []int `json:"attention_mask"`
+}
+
+// Encode returns the ids of text between Class and Sep, truncated and padded
+// to maxLen, as encode_plus does with truncation=True and
+// padding='max_length'.
+func (t *Tokenizer) Encode(text string, maxLen int) Encoding {
+	tokens := t.Tokenize(text)
+	if len(tokens) > maxLen-2 {
+		tokens = tokens[:max(maxLen-2, 0)]
+	}
+
+	e := Encoding{InputIDs: make([]int, 0, maxLen), AttentionMask: make([]int, 0, maxLen)}
+	e.InputIDs = append(e.InputIDs, t.cls)
+	for _, token := range tokens {
+		id, ok := t.vocab.ID(token)
+		if !ok {
+			id = t.unk
+		}
+		e.InputIDs = append(e.InputIDs, id)
+	}
+	e.InputIDs = append(e.InputIDs, t.sep)
+	for range e.InputIDs {
+		e.AttentionMask = append(e.AttentionMask, 1)
+	}
+	for len(e.InputIDs) < maxLen {
+		e.InputIDs = append(e.InputIDs, t.pad)
+		e.AttentionMask = append(e.AttentionMask, 0)
+	}
+	return e
+}
+
+// BasicTokenize cleans text and splits it into words and punctuation marks.
+// Control characters are dropped, whitespace separates words, and CJK
+// ideographs are words of their own.
+func BasicTokenize(text string, opts Options) []string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == 0 || r == utf8.RuneError || isControl(r):
+		case isWhitespace(r):
+			b.WriteByte(' ')
+		case isCJK(r):
+			b.WriteByte(' ')
+			b.WriteRune(r)
+			b.WriteByte(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	text = b.String()
+	if opts.StripAccents {
+		text = stripAccents(text)
+	}
+	if opts.Lowercase {
+		text = strings.ToLower(text)
+	}
+
+	var words []string
+	for _, field := range strings.FieldsFunc(text, isWhitespace) {
+		start := 0
+		for i, r := range field {
+			if !isPunctuation(r) {
+				continue
+			}
+			if start < i {
+				words = append(words, field[start:i])
+			}
+			start = i + utf8.RuneLen(r)
+			words = append(words, field[i:start])
+		}
+		if start < len(field) {
+			words = append(words, field[start:])
+		}
+	}
+	return words
+}
+
+func stripAccents(text string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isWhitespace(r rune) bool {
+	return unicode.IsSpace(r)
+}
+
+// isControl reports whether r is in one of the "other" categories, including
+// unassigned code points. Tabs and line breaks count as whitespace.
+func isControl(r rune) bool {
+	if r == '\t' || r == '\n' || r == '\r' {
+		return false
+	}
+	return !unicode.In(r, unicode.L, unicode.M, unicode.N, unicode.P, unicode.S, unicode.Z)
+}
+
+// isPunctuation reports whether r is a punctuation mark, or any ASCII
+// character other than a letter, digit or space, such as "$" or "^".
+func isPunctuation(r rune) bool {
+	if r >= 33 && r <= 47 || r >= 58 && r <= 64 || r >= 91 && r <= 96 || r >= 123 && r <= 126 {
+		return true
+	}
+	return unicode.IsPunct(r)
+}
+
+// isCJK reports whether r is a CJK ideograph. Hangul and kana are not,
+// they are written with spaces.
+func isCJK(r rune) bool {
+	return r >= 0x4E00 && r <= 0x9FFF ||
+		r >= 0x3400 && r <= 0x4DBF ||
+		r >= 0x20000 && r <= 0x2A6DF ||
+		r >= 0x2A700 && r <= 0x2B73F ||
+		r >= 0x2B740 && r <= 0x2B81F ||
+		r >= 0x2B820 && r <= 0x2CEAF ||
+		r >= 0xF900 && r <= 0xFAFF ||
+		r >= 0x2F800 && r <= 0x2FA1F
+}
@@ -0,0 +1,146 @@
+package wordpiece
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readJSONLines decodes each line of the file at path into a new T.
+func readJSONLines[T any](t *testing.T, path string) []T {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var values []T
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var v T
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &v))
+		values = append(values, v)
+	}
+	assert.NoError(t, scanner.Err())
+	return values
+}
+
+// TestReference checks the cases of the HuggingFace BertTokenizer tests,
+// stored in testdata/reference.jsonl, against testdata/vocab.txt.
+func TestReference(t *testing.T) {
+	vocab, err := LoadVocab("testdata/vocab.txt")
+	assert.NoError(t, err)
+
+	type reference struct {
+		Text         string   `json:"text"`
+		Lowercase    bool     `json:"lowercase"`
+		StripAccents bool     `json:"strip_accents"`
+		Basic        []string `json:"basic"`
+		Tokens       []string `json:"tokens"`
+		IDs          []int    `json:"ids"`
+	}
+	for _, ref := range readJSONLines[reference](t, "testdata/reference.jsonl") {
+		opts := Options{Lowercase: ref.Lowercase, StripAccents: ref.StripAccents}
+		assert.Equal(t, ref.Basic, append([]string{}, BasicTokenize(ref.Text, opts)...), ref.Text)
+		if ref.Tokens == nil {
+			continue
+		}
+
+		tokenizer, err := New(vocab, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, ref.Tokens, append([]string{}, tokenizer.Tokenize(ref.Text)...), ref.Text)
+		e := tokenizer.Encode(ref.Text, len(ref.IDs)+2)
+		assert.Equal(t, append(append([]int{1}, ref.IDs...), 2), e.InputIDs, ref.Text)
+	}
+}
+
+func TestBasicTokenizeRussian(t *testing.T) {
+	assert.Equal(t,
+		[]string{"«", "Привет", "»", ",", "—", "сказал", "Пётр", "…", "Ёлка", "!", "3", ".", "14"},
+		BasicTokenize("«Привет», — сказал Пётр​… Ёлка! 3.14", Options{}))
+	assert.Equal(t, []string{"привет", "елка"}, BasicTokenize("Привет Ёлка", Options{Lowercase: true, StripAccents: true}))
+}
+
+func TestWordPieceLongWord(t *testing.T) {
+	vocab, err := ReadVocab(strings.NewReader("[PAD]\n[UNK]\n[CLS]\n[SEP]\na\n##a\n"))
+	assert.NoError(t, err)
+	tokenizer, err := New(vocab, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "##a", "##a"}, tokenizer.WordPiece("aaa"))
+	assert.Equal(t, []string{Unknown}, tokenizer.WordPiece(strings.Repeat("a", 101)))
+}
+
+func TestEncode(t *testing.T) {
+	vocab, err := LoadVocab("testdata/vocab.txt")
+	assert.NoError(t, err)
+	tokenizer, err := New(vocab, Options{})
+	assert.NoError(t, err)
+
+	e := tokenizer.Encode("unwanted running", 8)
+	assert.Equal(t, []int{1, 9, 6, 7, 10, 11, 2, 3}, e.InputIDs)
+	assert.Equal(t, []int{1, 1, 1, 1, 1, 1, 1, 0}, e.AttentionMask)
+
+	// Truncated to leave room for the special tokens.
+	e = tokenizer.Encode("unwanted running", 5)
+	assert.Equal(t, []int{1, 9, 6, 7, 2}, e.InputIDs)
+	assert.Equal(t, []int{1, 1, 1, 1, 1}, e.AttentionMask)
+
+	_, err = New(&Vocab{ids: map[string]int{}}, Options{})
+	assert.Error(t, err)
+}
+
+// TestCyrillic checks the cases rubert-base-cased sees most in Russian
+// books on a small vocabulary, with the outputs BertTokenizer gives for a
+// cased vocabulary: case and ё are kept, Russian quotes, dashes and the
+// ellipsis are words of their own, and a word with a piece missing from the
+// vocabulary, or longer than 100 runes, is [UNK].
+func TestCyrillic(t *testing.T) {
+	vocab, err := ReadVocab(strings.NewReader(strings.Join([]string{
+		"[PAD]", "[UNK]", "[CLS]", "[SEP]", "«", "»", ",", "—", "…", "!",
+		"Ел", "##ка", "Ёлка", "ёж", "сказал", "он", "При", "##вет", "мир", "Мир", "а", "##а",
+	}, "\n")))
+	assert.NoError(t, err)
+	tokenizer, err := New(vocab, Options{})
+	assert.NoError(t, err)
+
+	for text, want := range map[string][]string{
+		"«Привет, мир!» — сказал он…": {"«", "При", "##вет", ",", "мир", "!", "»", "—", "сказал", "он", "…"},
+		"Ёлка Елка ёж":                {"Ёлка", "Ел", "##ка", "ёж"},
+		"Мир мир МИР":                 {"Мир", "мир", Unknown},
+		"Приветик":                    {Unknown},
+	} {
+		assert.Equal(t, want, tokenizer.Tokenize(text), text)
+	}
+
+	pieces := tokenizer.Tokenize(strings.Repeat("а", 100))
+	assert.Len(t, pieces, 100)
+	assert.Equal(t, []string{"а", "##а"}, pieces[:2])
+	assert.Equal(t, []string{Unknown}, tokenizer.Tokenize(strings.Repeat("а", 101)))
+}
+
+// TestRubertParity compares the tokenizer with HuggingFace on the outputs
+// stored by testdata/make_rubert_reference.py. It is skipped until they are
+// generated, as the vocabulary is not part of the repository.
+func TestRubertParity(t *testing.T) {
+	if _, err := os.Stat("testdata/rubert/reference.jsonl"); err != nil {
+		t.Skip("no rubert reference outputs, see testdata/make_rubert_reference.py")
+	}
+	tokenizer, err := Load("testdata/rubert/vocab.txt", Options{})
+	assert.NoError(t, err)
+
+	type reference struct {
+		Text          string   `json:"text"`
+		Tokens        []string `json:"tokens"`
+		InputIDs      []int    `json:"input_ids"`
+		AttentionMask []int    `json:"attention_mask"`
+	}
+	for _, ref := range readJSONLines[reference](t, "testdata/rubert/reference.jsonl") {
+		assert.Equal(t, ref.Tokens, append([]string{}, tokenizer.Tokenize(ref.Text)...), ref.Text)
+		e := tokenizer.Encode(ref.Text, len(ref.InputIDs))
+		assert.Equal(t, ref.InputIDs, e.InputIDs, ref.Text)
+		assert.Equal(t, ref.AttentionMask, e.AttentionMask, ref.Text)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"ArchiveProcessor/fb2"
+	"ArchiveProcessor/sink"
+	"context"
+	"fmt"
+	"log"
+
+	pb "github.com/schollz/progressbar/v3"
+)
+
+// archiveRun is the progress of an archive. Its stats and bar are only
+// touched by the output writer.
+type archiveRun struct {
+	file  string
+	bar   *pb.ProgressBar
+	stats *ExtractionStats
+}
+
+// bookResult is sent to the output writer for every entry of an archive, and
+// once more at the end of the archive.
+type bookResult struct {
+	// seq numbers the results of a run in the order the entries were
+	// dispatched, that is archive order, then entry order.
+	seq      int
+	archive  *archiveRun
+	entry    string
+	record   fb2.Record
+	encoding string
+	// err is the reason the book was rejected.
+	err error
+	// skipped is set for entries handled by an earlier run.
+	skipped bool
+
+	// end marks the end of the archive, complete if all of its entries were
+	// dispatched. flushed is closed once the end is handled.
+	end      bool
+	complete bool
+	flushed  chan struct{}
+}
+
+// outputWriter is the only goroutine writing to the output and checkpoint.
+// In ordered mode results are held back until those dispatched before them
+// are written, so that the output does not depend on scheduling.
+type outputWriter struct {
+	out        sink.Sink
+	checkpoint *Checkpoint
+	report     *RunReport
+	ordered    bool
+	// abort stops the dispatching of books after a write error.
+	abort context.CancelFunc
+
+	results chan bookResult
+	done    chan struct{}
+	err     error
+}
+
+func startOutputWriter(out sink.Sink, checkpoint *Checkpoint, report *RunReport, ordered bool, abort context.CancelFunc) *outputWriter {
+	w := &outputWriter{
+		out:        out,
+		checkpoint: checkpoint,
+		report:     report,
+		ordered:    ordered,
+		abort:      abort,
+		results:    make(chan bookResult, 64),
+		done:       make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// send hands a result to the writer.
+func (w *outputWriter) send(r bookResult) {
+	w.results <- r
+}
+
+// Close waits for the results sent so far to be handled and returns the
+// error that aborted the run, if any.
+func (w *outputWriter) Close() error {
+	close(w.results)
+	<-w.done
+	return w.err
+}
+
+func (w *outputWriter) run() {
+	defer close(w.done)
+
+	pending := make(map[int]bookResult)
+	next := 0
+	for r := range w.results {
+		if !w.ordered {
+			w.handle(r)
+			continue
+		}
+		pending[r.seq] = r
+		for r, ok := pending[next]; ok; r, ok = pending[next] {
+			delete(pending, next)
+			w.handle(r)
+			next++
+		}
+	}
+}
+
+func (w *outputWriter) handle(r bookResult) {
+	if r.flushed != nil {
+		defer close(r.flushed)
+	}
+	if w.err != nil {
+		// The run is aborted, drop the books still in flight.
+		return
+	}
+
+	a := r.archive
+	switch {
+	case r.end:
+		a.bar.Finish()
+		fmt.Println()
+		a.stats.Print(log.Writer(), a.file)
+		w.report.addArchive(a.file, a.stats)
+		if r.complete {
+			if err := w.checkpoint.MarkArchive(a.file); err != nil {
+				w.fail(fmt.Errorf("error writing checkpoint: %w", err))
+			}
+		}
+		return
+	case r.skipped:
+		a.stats.Skipped++
+		a.bar.Add(1)
+		return
+	case r.err != nil:
+		log.Printf("Error extracting book %s/%s [%s]: %+v\n", a.file, r.entry, ReasonOf(r.err), r.err)
+	default:
+		if err := w.out.Write(&r.record); err != nil {
+			w.fail(fmt.Errorf("error writing %s: %w", r.record.ID, err))
+			return
+		}
+	}
+	a.stats.add(r.encoding, r.err)
+
+	// The book is checkpointed after its record is written.
+	if err := w.checkpoint.MarkEntry(a.file, r.entry); err != nil {
+		w.fail(fmt.Errorf("error writing checkpoint: %w", err))
+		return
+	}
+	a.bar.Add(1)
+}
+
+func (w *outputWriter) fail(err error) {
+	w.err = err
+	log.Println(err)
+	w.abort()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"ArchiveProcessor/fb2"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/schollz/progressbar/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSink struct {
+	ids  []string
+	fail bool
+}
+
+func (s *recordingSink) Write(rec *fb2.Record) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	s.ids = append(s.ids, rec.ID)
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestOutputWriterOrdered(t *testing.T) {
+	checkpoint, err := OpenCheckpoint(filepath.Join(t.TempDir(), "out.checkpoint"), false)
+	assert.NoError(t, err)
+	defer checkpoint.Close()
+
+	out := &recordingSink{}
+	report := newRunReport()
+	ctx, abort := context.WithCancel(context.Background())
+	defer abort()
+	w := startOutputWriter(out, checkpoint, report, true, abort)
+
+	archive := &archiveRun{file: "a.zip", bar: pb.DefaultSilent(5), stats: newExtractionStats()}
+	for _, seq := range []int{3, 1, 4, 0, 2} {
+		r := bookResult{seq: seq, archive: archive, entry: fmt.Sprintf("%d.fb2", seq)}
+		r.record.ID = r.entry
+		if seq == 2 {
+			r.err = reject(ReasonNoTitle, "no title")
+		}
+		w.send(r)
+	}
+	flushed := make(chan struct{})
+	w.send(bookResult{seq: 5, archive: archive, end: true, complete: true, flushed: flushed})
+	<-flushed
+	assert.NoError(t, w.Close())
+	assert.NoError(t, ctx.Err())
+
+	assert.Equal(t, []string{"0.fb2", "1.fb2", "3.fb2", "4.fb2"}, out.ids)
+	assert.Equal(t, 4, archive.stats.Accepted)
+	assert.Equal(t, 1, archive.stats.ByReason[ReasonNoTitle])
+	assert.True(t, checkpoint.EntryDone("a.zip", "2.fb2"))
+	assert.True(t, checkpoint.ArchiveDone("a.zip"))
+	assert.Len(t, report.Archives, 1)
+}
+
+func TestOutputWriterAborts(t *testing.T) {
+	checkpoint, err := OpenCheckpoint(filepath.Join(t.TempDir(), "out.checkpoint"), false)
+	assert.NoError(t, err)
+	defer checkpoint.Close()
+
+	ctx, abort := context.WithCancel(context.Background())
+	defer abort()
+	w := startOutputWriter(&recordingSink{fail: true}, checkpoint, newRunReport(), false, abort)
+
+	archive := &archiveRun{file: "a.zip", bar: pb.DefaultSilent(2), stats: newExtractionStats()}
+	w.send(bookResult{seq: 0, archive: archive, entry: "0.fb2"})
+	w.send(bookResult{seq: 1, archive: archive, entry: "1.fb2"})
+	err = w.Close()
+
+	assert.ErrorContains(t, err, "disk full")
+	assert.Error(t, ctx.Err())
+	// Nothing is checkpointed, so a resumed run extracts the books again.
+	assert.False(t, checkpoint.EntryDone("a.zip", "0.fb2"))
+	assert.Equal(t, 0, archive.stats.Total)
+}